@@ -0,0 +1,148 @@
+package simpool
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatchFunc executes a batch of items as one job.
+// it returns a JobResult for each item in the same order.
+type BatchFunc func(items []interface{}) []*JobResult
+
+// Batcher groups items into batches of 'size' items, or whatever has
+// built up after 'interval' since the first item of the batch, and runs
+// each batch as one job on the pool.
+type Batcher struct {
+	pool     *Pool
+	size     int
+	interval time.Duration
+	fn       BatchFunc
+	opts     []SubmitOption
+
+	mu      sync.Mutex
+	items   []interface{}
+	waiters []chan *JobResult
+	seq     uint64 // increases whenever a batch is flushed
+}
+
+// NewBatcher create batcher which runs 'fn' on the pool.
+// 'opts' apply to the job of every batch.
+func NewBatcher(pool *Pool, size int, interval time.Duration, fn BatchFunc, opts ...SubmitOption) *Batcher {
+	if size < 1 {
+		size = 1
+	}
+	return &Batcher{
+		pool:     pool,
+		size:     size,
+		interval: interval,
+		fn:       fn,
+		opts:     opts,
+	}
+}
+
+// Queue an item into the current batch
+func (b *Batcher) Queue(item interface{}) {
+	b.add(item, nil)
+}
+
+// QueueAndWait an item into the current batch and
+// wait for the result of the item once the batch has run
+func (b *Batcher) QueueAndWait(item interface{}) *JobResult {
+	res := make(chan *JobResult, 1)
+	b.add(item, res)
+	return <-res
+}
+
+// Flush runs the current batch now, however small it is
+func (b *Batcher) Flush() {
+	b.mu.Lock()
+	b.flush()
+}
+
+// Close runs the remaining items. Close the pool afterwards to wait for them.
+func (b *Batcher) Close() {
+	b.Flush()
+}
+
+func (b *Batcher) add(item interface{}, res chan *JobResult) {
+	b.mu.Lock()
+	b.items = append(b.items, item)
+	b.waiters = append(b.waiters, res)
+	if len(b.items) >= b.size {
+		b.flush()
+		return
+	}
+	if len(b.items) == 1 && b.interval > 0 {
+		seq := b.seq
+		time.AfterFunc(b.interval, func() {
+			b.mu.Lock()
+			if b.seq != seq {
+				// flushed already by size
+				b.mu.Unlock()
+				return
+			}
+			b.flush()
+		})
+	}
+	b.mu.Unlock()
+}
+
+// flush queues the current batch into the pool.
+// it is called with 'b.mu' held and unlocks it, so that
+// the caller blocks on a full pool without blocking other callers.
+func (b *Batcher) flush() {
+	items, waiters := b.items, b.waiters
+	b.items, b.waiters = nil, nil
+	b.seq++
+	b.mu.Unlock()
+	if len(items) == 0 {
+		return
+	}
+
+	job := &batchJob{fn: b.fn, items: items}
+	j := newInternalJob(job, false, b.opts)
+	j.addOnFinish(func(res *JobResult) {
+		fanOut(waiters, res)
+	})
+	b.pool.submit(j)
+}
+
+// fanOut delivers the result of each item of the batch
+func fanOut(waiters []chan *JobResult, res *JobResult) {
+	results, ok := res.resultsOf(len(waiters))
+	for i, w := range waiters {
+		if w == nil {
+			continue
+		}
+		if ok {
+			w <- results[i]
+		} else {
+			w <- res
+		}
+		close(w)
+	}
+}
+
+// resultsOf returns the results of the items of a batch job which has run
+func (r *JobResult) resultsOf(n int) ([]*JobResult, bool) {
+	if r == nil || r.Err != nil {
+		return nil, false
+	}
+	results, ok := r.Res.([]*JobResult)
+	return results, ok && len(results) == n
+}
+
+// batchJob runs a batch of items
+type batchJob struct {
+	fn    BatchFunc
+	items []interface{}
+}
+
+func (s *batchJob) Execute() *JobResult {
+	results := s.fn(s.items)
+	if len(results) != len(s.items) {
+		return &JobResult{Err: fmt.Errorf("simpool: batch returned %v results for %v items", len(results), len(s.items))}
+	}
+	return &JobResult{Res: results}
+}
@@ -0,0 +1,90 @@
+package simpool
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcherBySize(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	gp := NewPool(4, 10)
+	b := NewBatcher(gp, 10, time.Hour, func(items []interface{}) []*JobResult {
+		mu.Lock()
+		sizes = append(sizes, len(items))
+		mu.Unlock()
+		results := make([]*JobResult, len(items))
+		for i, item := range items {
+			results[i] = &JobResult{Res: strconv.Itoa(item.(int))}
+		}
+		return results
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			r := b.QueueAndWait(n)
+			if r.Err != nil || r.Res.(string) != strconv.Itoa(n) {
+				t.Errorf("unexpected result %v for %v", r, n)
+			}
+		}(i)
+	}
+	wg.Wait()
+	b.Close()
+	gp.Close()
+
+	if len(sizes) != 5 {
+		t.Fatalf("expected 5 batches, got %v", sizes)
+	}
+}
+
+func TestBatcherByInterval(t *testing.T) {
+	gp := NewPool(1, 10)
+	b := NewBatcher(gp, 100, 10*time.Millisecond, func(items []interface{}) []*JobResult {
+		return make([]*JobResult, len(items))
+	})
+	start := time.Now()
+	b.Queue(1)
+	if r := b.QueueAndWait(2); r != nil {
+		t.Fatalf("unexpected result %v", r)
+	}
+	if time.Since(start) < 10*time.Millisecond {
+		t.Fatal("flushed before the interval")
+	}
+	b.Close()
+	gp.Close()
+}
+
+func TestBatcherFailure(t *testing.T) {
+	gp := NewPool(1, 10)
+	b := NewBatcher(gp, 2, time.Hour, func(items []interface{}) []*JobResult {
+		return nil
+	})
+	res := make(chan *JobResult, 1)
+	go func() {
+		res <- b.QueueAndWait(1)
+	}()
+	if r := b.QueueAndWait(2); r.Err == nil {
+		t.Fatal("expected an error for a batch without results")
+	}
+	if r := <-res; r.Err == nil {
+		t.Fatal("expected every item to get the error")
+	}
+	gp.Close()
+
+	gate := make(chan struct{})
+	gp = NewPool(1, 1, WithOverflowPolicy(OverflowReject))
+	fillPool(gp, gate)
+	b = NewBatcher(gp, 1, time.Hour, func(items []interface{}) []*JobResult {
+		return nil
+	})
+	if r := b.QueueAndWait(1); r.Err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", r.Err)
+	}
+	close(gate)
+	gp.Close()
+}
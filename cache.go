@@ -0,0 +1,127 @@
+package simpool
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CacheableJob is a Job whose successful result can be reused for
+// other jobs with the same cache key while the result is fresh
+type CacheableJob interface {
+	Job
+	CacheKey() string
+}
+
+// cacheEntry is a cached result
+type cacheEntry struct {
+	key     string
+	res     *JobResult
+	expires time.Time
+}
+
+// resultCache is an LRU cache of results which expire after 'ttl'
+type resultCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	lru   *list.List // front is the most recently used
+	items map[string]*list.Element
+}
+
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		size:  size,
+		ttl:   ttl,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// WithResultCache caches the successful results of CacheableJob for 'ttl',
+// holding at most 'size' results and evicting the least recently used.
+// a job whose result is cached is answered without using a worker.
+func WithResultCache(size int, ttl time.Duration) Option {
+	return func(p *Pool) {
+		p.cache = newResultCache(size, ttl)
+	}
+}
+
+// get returns the fresh result of the key
+func (c *resultCache) get(key string, now time.Time) (*JobResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if now.After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.res, true
+}
+
+// put stores the result of the key
+func (c *resultCache) put(key string, res *JobResult, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*cacheEntry)
+		e.res = res
+		e.expires = now.Add(c.ttl)
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.lru.PushFront(&cacheEntry{key: key, res: res, expires: now.Add(c.ttl)})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// remove forgets the result of the key
+func (c *resultCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.lru.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+// lookup answers the job from the cache. on a miss the result of the job is
+// cached once it succeeds. it returns true if the job was answered.
+func (p *Pool) lookup(j *internalJob) bool {
+	cj, ok := j.Job.(CacheableJob)
+	if p.cache == nil || !ok {
+		return false
+	}
+	key := cj.CacheKey()
+	if res, ok := p.cache.get(key, time.Now()); ok {
+		p.counters.inc(&p.counters.cacheHits)
+		j.finish(res)
+		return true
+	}
+	p.counters.inc(&p.counters.cacheMisses)
+	j.addOnFinish(func(res *JobResult) {
+		if res != nil && res.Err == nil {
+			p.cache.put(key, res, time.Now())
+		}
+	})
+	return false
+}
+
+// InvalidateCache removes the cached result of the cache key
+func (p *Pool) InvalidateCache(key string) {
+	if p.cache != nil {
+		p.cache.remove(key)
+	}
+}
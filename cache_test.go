@@ -0,0 +1,76 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type LookupJob struct {
+	key string
+	cnt *int32
+	err error
+}
+
+func (s *LookupJob) CacheKey() string {
+	return s.key
+}
+
+func (s *LookupJob) Execute() *JobResult {
+	atomic.AddInt32(s.cnt, 1)
+	return &JobResult{Res: s.key, Err: s.err}
+}
+
+func TestResultCache(t *testing.T) {
+	var cnt int32
+	gp := NewPool(2, 10, WithResultCache(2, time.Hour))
+	defer gp.Close()
+
+	for i := 0; i < 3; i++ {
+		r := gp.QueueAndWait(&LookupJob{"a", &cnt, nil})
+		if r.Res.(string) != "a" {
+			t.Fatalf("unexpected result %v", r)
+		}
+	}
+	if cnt != 1 {
+		t.Fatalf("expected a single execution, got %v", cnt)
+	}
+
+	// "a" is evicted as the least recently used
+	gp.QueueAndWait(&LookupJob{"b", &cnt, nil})
+	gp.QueueAndWait(&LookupJob{"c", &cnt, nil})
+	gp.QueueAndWait(&LookupJob{"a", &cnt, nil})
+	if cnt != 4 {
+		t.Fatalf("expected 4 executions, got %v", cnt)
+	}
+
+	gp.InvalidateCache("a")
+	gp.QueueAndWait(&LookupJob{"a", &cnt, nil})
+	if cnt != 5 {
+		t.Fatalf("expected 5 executions, got %v", cnt)
+	}
+
+	s := gp.Stats()
+	if s.CacheHits != 2 || s.CacheMisses != 5 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestResultCacheSkipsFailures(t *testing.T) {
+	var cnt int32
+	gp := NewPool(1, 10, WithResultCache(10, 10*time.Millisecond))
+	defer gp.Close()
+
+	gp.QueueAndWait(&LookupJob{"a", &cnt, ErrJobDropped})
+	gp.QueueAndWait(&LookupJob{"a", &cnt, nil})
+	gp.QueueAndWait(&LookupJob{"a", &cnt, nil})
+	if cnt != 2 {
+		t.Fatalf("expected 2 executions, got %v", cnt)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	gp.QueueAndWait(&LookupJob{"a", &cnt, nil})
+	if cnt != 3 {
+		t.Fatalf("expected the result to expire, got %v executions", cnt)
+	}
+}
@@ -0,0 +1,68 @@
+package simpool
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOverloaded is returned when the job is shed by CoDel load shedding
+var ErrOverloaded = errors.New("simpool: pool is overloaded")
+
+// codel tracks queue sojourn time as in the CoDel algorithm.
+// the pool is considered overloaded once the sojourn time has stayed
+// above 'target' for at least 'interval', and recovers as soon as
+// a job is dequeued below 'target' or the queue becomes empty.
+type codel struct {
+	mu         sync.Mutex
+	target     time.Duration
+	interval   time.Duration
+	firstAbove time.Time
+	dropping   bool
+}
+
+func newCodel(target, interval time.Duration) *codel {
+	return &codel{
+		target:   target,
+		interval: interval,
+	}
+}
+
+// observe records the sojourn time of a dequeued job
+func (c *codel) observe(sojourn time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if sojourn < c.target {
+		c.firstAbove = time.Time{}
+		c.dropping = false
+		return
+	}
+	if c.firstAbove.IsZero() {
+		c.firstAbove = now.Add(c.interval)
+		return
+	}
+	if !now.Before(c.firstAbove) {
+		c.dropping = true
+	}
+}
+
+// overloaded reports whether new work should be shed
+func (c *codel) overloaded(queued int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if queued == 0 {
+		c.firstAbove = time.Time{}
+		c.dropping = false
+	}
+	return c.dropping
+}
+
+// WithCoDel rejects new jobs with ErrOverloaded while the minimum time
+// jobs wait in the queue stays above 'target' for longer than 'interval'
+func WithCoDel(target, interval time.Duration) Option {
+	return func(p *Pool) {
+		p.codel = newCodel(target, interval)
+	}
+}
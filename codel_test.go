@@ -0,0 +1,48 @@
+package simpool
+
+import (
+	"testing"
+	"time"
+)
+
+type SleepJob struct {
+	d time.Duration
+}
+
+func (s *SleepJob) Execute() *JobResult {
+	time.Sleep(s.d)
+	return nil
+}
+
+func TestCodelSheds(t *testing.T) {
+	gp := NewPool(1, 100, WithCoDel(time.Millisecond, 10*time.Millisecond))
+	for i := 0; i < 20; i++ {
+		if err := gp.Queue(&SleepJob{5 * time.Millisecond}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := gp.Queue(&SleepJob{}); err != ErrOverloaded {
+		t.Fatalf("expected ErrOverloaded, got %v", err)
+	}
+	gp.Close()
+
+	if s := gp.Stats(); s.Shed != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCodelRecovers(t *testing.T) {
+	c := newCodel(time.Millisecond, 10*time.Millisecond)
+	now := time.Now()
+	c.observe(5*time.Millisecond, now)
+	c.observe(5*time.Millisecond, now.Add(20*time.Millisecond))
+	if !c.overloaded(1) {
+		t.Fatal("expected overloaded")
+	}
+	c.observe(0, now.Add(30*time.Millisecond))
+	if c.overloaded(1) {
+		t.Fatal("expected recovered after a short sojourn")
+	}
+}
@@ -0,0 +1,87 @@
+package simpool
+
+import "sync"
+
+// CostJob is a Job which declares how many worker slots it occupies,
+// such as a big export against a single-row insert
+type CostJob interface {
+	Job
+	Cost() int
+}
+
+// WithCost sets how many worker slots the job occupies.
+// it overrides the cost declared by CostJob.
+func WithCost(cost int) SubmitOption {
+	return func(j *internalJob) {
+		j.Cost = cost
+	}
+}
+
+// slotWaiter is a worker waiting for slots
+type slotWaiter struct {
+	n     int
+	ready chan struct{}
+}
+
+// slots is a weighted semaphore of worker slots.
+// waiters are served in order, so that a heavy job is not starved by light ones.
+type slots struct {
+	mu      sync.Mutex
+	size    int
+	used    int
+	waiters []*slotWaiter
+}
+
+func newSlots(size int) *slots {
+	return &slots{size: size}
+}
+
+// acquire blocks until 'n' slots are free
+func (s *slots) acquire(n int) {
+	s.mu.Lock()
+	if len(s.waiters) == 0 && s.used+n <= s.size {
+		s.used += n
+		s.mu.Unlock()
+		return
+	}
+	w := &slotWaiter{n: n, ready: make(chan struct{})}
+	s.waiters = append(s.waiters, w)
+	s.mu.Unlock()
+	<-w.ready
+}
+
+// release frees 'n' slots and wakes the waiters which fit in order
+func (s *slots) release(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.used -= n
+	for len(s.waiters) > 0 {
+		w := s.waiters[0]
+		if s.used+w.n > s.size {
+			break
+		}
+		s.used += w.n
+		s.waiters[0] = nil
+		s.waiters = s.waiters[1:]
+		close(w.ready)
+	}
+}
+
+// inUse returns the number of slots occupied
+func (s *slots) inUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// cost returns the cost of the job clamped to the number of workers
+func (p *Pool) cost(j *internalJob) int {
+	if j.Cost < 1 {
+		return 1
+	}
+	if j.Cost > p.noOfWorkers && p.noOfWorkers > 0 {
+		return p.noOfWorkers
+	}
+	return j.Cost
+}
@@ -0,0 +1,86 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// WeightJob tracks the total cost of the jobs running at once in a pool of 4 workers
+type WeightJob struct {
+	cost    int
+	running *int32
+	max     *int32
+}
+
+func (s *WeightJob) Cost() int {
+	return s.cost
+}
+
+func (s *WeightJob) Execute() *JobResult {
+	cost := int32(s.cost)
+	if cost > 4 {
+		cost = 4
+	}
+	n := atomic.AddInt32(s.running, cost)
+	for {
+		m := atomic.LoadInt32(s.max)
+		if n <= m || atomic.CompareAndSwapInt32(s.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(2 * time.Millisecond)
+	atomic.AddInt32(s.running, -cost)
+	return nil
+}
+
+func TestCostLimitsRunningJobs(t *testing.T) {
+	var running, max int32
+	gp := NewPool(4, 100)
+	for i := 0; i < 30; i++ {
+		gp.Queue(&WeightJob{1, &running, &max})
+		if i%5 == 0 {
+			gp.Queue(&WeightJob{3, &running, &max})
+		}
+	}
+	// larger than the pool, so it is clamped to 4
+	gp.Queue(&WeightJob{10, &running, &max})
+	gp.Close()
+
+	if max > 4 {
+		t.Fatalf("running cost exceeded the slots, %v", max)
+	}
+	if s := gp.Stats(); s.Completed != 37 || s.BusySlots != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCostAdmission(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(2, 4, WithOverflowPolicy(OverflowReject))
+	for i := 0; i < 2; i++ {
+		running := NewGateJob("running", gate)
+		gp.Queue(running)
+		<-running.started
+	}
+
+	var cnt int32
+	if err := gp.Queue(&CountJob{&cnt}, WithCost(2)); err != nil {
+		t.Fatal(err)
+	}
+	// clamped to the 2 workers
+	if err := gp.Queue(&CountJob{&cnt}, WithCost(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gp.Queue(&CountJob{&cnt}); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	if s := gp.Stats(); s.QueuedCost != 4 || s.Queued != 2 || s.BusySlots != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	close(gate)
+	gp.Close()
+	if cnt != 2 {
+		t.Fatalf("expected 2 jobs, got %v", cnt)
+	}
+}
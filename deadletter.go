@@ -0,0 +1,419 @@
+package simpool
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDeadLetterNotFound is returned when there is no dead letter of the id
+	ErrDeadLetterNotFound = errors.New("simpool: dead letter not found")
+	// ErrStoreClosed is returned when a FileDeadLetterStore is used after Close
+	ErrStoreClosed = errors.New("simpool: dead letter store closed")
+)
+
+// DeadLetter is a job which failed on its last attempt
+type DeadLetter struct {
+	ID       uint64
+	Job      Job      // nil if the store could not keep the job
+	Errors   []string // the error of every attempt, oldest first
+	FailedAt time.Time
+}
+
+// DeadLetterStore keeps dead letters until they are requeued or purged
+type DeadLetterStore interface {
+	// Add stores the dead letter and sets its ID
+	Add(dl *DeadLetter) error
+	// List returns the dead letters in the order they were added
+	List() ([]*DeadLetter, error)
+	// Get returns the dead letter of the id
+	Get(id uint64) (*DeadLetter, error)
+	// Remove deletes the dead letter of the id
+	Remove(id uint64) error
+}
+
+// WithDeadLetters moves a job which failed on its last attempt, see WithRetries,
+// to 'store' along with the errors of its attempts. its waiter still gets the error.
+func WithDeadLetters(store DeadLetterStore) Option {
+	return func(p *Pool) {
+		p.deadLetters = store
+	}
+}
+
+// bury moves the failed job to the dead-letter store
+func (p *Pool) bury(e *internalJob) {
+	if p.deadLetters == nil {
+		return
+	}
+	dl := &DeadLetter{
+		Job:      e.Job,
+		Errors:   e.errs,
+		FailedAt: time.Now(),
+	}
+	if p.deadLetters.Add(dl) == nil {
+		p.counters.inc(&p.counters.deadLettered)
+	}
+}
+
+// DeadLetters lists the dead letters
+func (p *Pool) DeadLetters() ([]*DeadLetter, error) {
+	if p.deadLetters == nil {
+		return nil, nil
+	}
+	return p.deadLetters.List()
+}
+
+// InspectDeadLetter returns the dead letter of the id
+func (p *Pool) InspectDeadLetter(id uint64) (*DeadLetter, error) {
+	if p.deadLetters == nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	return p.deadLetters.Get(id)
+}
+
+// RequeueDeadLetter queues the job of the dead letter of the id again and
+// removes the dead letter. the dead letter is kept if the job is not queued.
+func (p *Pool) RequeueDeadLetter(id uint64, opts ...SubmitOption) error {
+	dl, err := p.InspectDeadLetter(id)
+	if err != nil {
+		return err
+	}
+	if dl.Job == nil {
+		return errors.New("simpool: dead letter has no job to requeue")
+	}
+	if err := p.Queue(dl.Job, opts...); err != nil {
+		return err
+	}
+	return p.deadLetters.Remove(id)
+}
+
+// PurgeDeadLetters deletes the dead letters of the ids, or every dead letter if none is given
+func (p *Pool) PurgeDeadLetters(ids ...uint64) error {
+	if p.deadLetters == nil {
+		return nil
+	}
+	if len(ids) == 0 {
+		list, err := p.deadLetters.List()
+		if err != nil {
+			return err
+		}
+		for _, dl := range list {
+			ids = append(ids, dl.ID)
+		}
+	}
+	for _, id := range ids {
+		if err := p.deadLetters.Remove(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryDeadLetterStore keeps dead letters in memory
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	nextID  uint64
+	letters map[uint64]*DeadLetter
+}
+
+// NewMemoryDeadLetterStore create empty in-memory store
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{
+		nextID:  1,
+		letters: make(map[uint64]*DeadLetter),
+	}
+}
+
+// Add stores the dead letter and sets its ID
+func (s *MemoryDeadLetterStore) Add(dl *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dl.ID = s.nextID
+	s.nextID++
+	s.letters[dl.ID] = dl
+	return nil
+}
+
+// List returns the dead letters in the order they were added
+func (s *MemoryDeadLetterStore) List() ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortLetters(s.letters), nil
+}
+
+// Get returns the dead letter of the id
+func (s *MemoryDeadLetterStore) Get(id uint64) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dl, ok := s.letters[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	return dl, nil
+}
+
+// Remove deletes the dead letter of the id
+func (s *MemoryDeadLetterStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.letters[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(s.letters, id)
+	return nil
+}
+
+func sortLetters(letters map[uint64]*DeadLetter) []*DeadLetter {
+	list := make([]*DeadLetter, 0, len(letters))
+	for _, dl := range letters {
+		list = append(list, dl)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].ID < list[b].ID })
+	return list
+}
+
+const (
+	recordDeadLetter byte = 3
+	recordPurge      byte = 4
+
+	deadLetterExt = ".dlq"
+)
+
+// fileLetter is how a dead letter is written to a FileDeadLetterStore
+type fileLetter struct {
+	Job      []byte // the job encoded by the codec
+	Errors   []string
+	FailedAt time.Time
+}
+
+// FileDeadLetterStore keeps dead letters in segment files in a directory.
+// jobs are encoded with a Codec, so their types must be registered in its
+// Registry. a job which cannot be encoded is kept without the job.
+type FileDeadLetterStore struct {
+	dir   string
+	codec Codec
+
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	seq     uint64
+	nextID  uint64
+	letters map[uint64]*DeadLetter
+	purged  int // records of purged letters in the active segment
+	closed  bool
+}
+
+// OpenFileDeadLetterStore opens the store in 'dir', creating it if needed
+func OpenFileDeadLetterStore(dir string, codec Codec) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &FileDeadLetterStore{
+		dir:     dir,
+		codec:   codec,
+		nextID:  1,
+		letters: make(map[uint64]*DeadLetter),
+	}
+	seqs, err := listSegments(dir, deadLetterExt)
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		err := readSegment(segmentName(dir, seq, deadLetterExt), func(r *record) error {
+			switch r.kind {
+			case recordDeadLetter:
+				dl, err := s.decode(r)
+				if err != nil {
+					return err
+				}
+				s.letters[r.id] = dl
+			case recordPurge:
+				delete(s.letters, r.id)
+			}
+			if r.id >= s.nextID {
+				s.nextID = r.id + 1
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		s.seq = seq
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileDeadLetterStore) encode(dl *DeadLetter) (*record, error) {
+	fl := fileLetter{Errors: dl.Errors, FailedAt: dl.FailedAt}
+	if dl.Job != nil {
+		data, err := s.codec.Encode(dl.Job)
+		if err != nil && !errors.Is(err, ErrJobNotRegistered) {
+			return nil, err
+		}
+		fl.Job = data
+	}
+	data, err := json.Marshal(fl)
+	if err != nil {
+		return nil, err
+	}
+	return &record{kind: recordDeadLetter, id: dl.ID, data: data}, nil
+}
+
+func (s *FileDeadLetterStore) decode(r *record) (*DeadLetter, error) {
+	var fl fileLetter
+	if err := json.Unmarshal(r.data, &fl); err != nil {
+		return nil, err
+	}
+	dl := &DeadLetter{ID: r.id, Errors: fl.Errors, FailedAt: fl.FailedAt}
+	if len(fl.Job) > 0 {
+		job, err := s.codec.Decode(fl.Job)
+		if err != nil && !errors.Is(err, ErrJobNotRegistered) {
+			return nil, err
+		}
+		dl.Job = job
+	}
+	return dl, nil
+}
+
+// write appends the record to the active segment and syncs it. 's.mu' must be held.
+func (s *FileDeadLetterStore) write(r *record) error {
+	if _, err := writeRecord(s.w, r); err != nil {
+		return err
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Add stores the dead letter and sets its ID
+func (s *FileDeadLetterStore) Add(dl *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	dl.ID = s.nextID
+	r, err := s.encode(dl)
+	if err != nil {
+		return err
+	}
+	if err := s.write(r); err != nil {
+		return err
+	}
+	s.nextID++
+	s.letters[dl.ID] = dl
+	return nil
+}
+
+// List returns the dead letters in the order they were added
+func (s *FileDeadLetterStore) List() ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return sortLetters(s.letters), nil
+}
+
+// Get returns the dead letter of the id
+func (s *FileDeadLetterStore) Get(id uint64) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dl, ok := s.letters[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	return dl, nil
+}
+
+// Remove deletes the dead letter of the id.
+// the files are compacted once most of their records are purged.
+func (s *FileDeadLetterStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if _, ok := s.letters[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	if err := s.write(&record{kind: recordPurge, id: id}); err != nil {
+		return err
+	}
+	delete(s.letters, id)
+	s.purged++
+	if s.purged > len(s.letters) {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact starts a new segment with the stored letters and removes
+// the older ones. 's.mu' must be held.
+func (s *FileDeadLetterStore) compact() error {
+	if s.f != nil {
+		if err := s.f.Close(); err != nil {
+			return err
+		}
+	}
+	old, err := listSegments(s.dir, deadLetterExt)
+	if err != nil {
+		return err
+	}
+
+	s.seq++
+	f, err := os.OpenFile(segmentName(s.dir, s.seq, deadLetterExt), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.w = bufio.NewWriter(f)
+	s.purged = 0
+	for _, dl := range sortLetters(s.letters) {
+		r, err := s.encode(dl)
+		if err != nil {
+			return err
+		}
+		if _, err := writeRecord(s.w, r); err != nil {
+			return err
+		}
+	}
+	// the new segment must be durable before the old ones go away
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+
+	for _, seq := range old {
+		if err := os.Remove(segmentName(s.dir, seq, deadLetterExt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the store
+func (s *FileDeadLetterStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.f.Close()
+}
@@ -0,0 +1,198 @@
+package simpool
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// FlakyJob fails until it has run 'failures' times
+type FlakyJob struct {
+	runs     *int32
+	failures int32
+	panics   bool
+}
+
+func (s *FlakyJob) Execute() *JobResult {
+	n := atomic.AddInt32(s.runs, 1)
+	if n > s.failures {
+		return &JobResult{Res: n}
+	}
+	if s.panics {
+		panic("flaky")
+	}
+	return &JobResult{Err: errors.New("flaky")}
+}
+
+func TestRetries(t *testing.T) {
+	var runs int32
+	gp := NewPool(1, 1, WithRetries(3, time.Millisecond))
+	r := gp.QueueAndWait(&FlakyJob{runs: &runs, failures: 2})
+	if r.Err != nil || r.Res.(int32) != 3 {
+		t.Fatalf("expected the third attempt to succeed, got %+v", r)
+	}
+
+	// Close waits for a job waiting for its backoff
+	runs = 0
+	gp.Queue(&FlakyJob{runs: &runs, failures: 1})
+	gp.Close()
+	if atomic.LoadInt32(&runs) != 2 {
+		t.Fatalf("expected 2 runs, got %v", runs)
+	}
+	if s := gp.Stats(); s.Retried != 3 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestRetryAfterStartDeadline(t *testing.T) {
+	var runs int32
+	gp := NewPool(1, 10, WithRetries(1, 50*time.Millisecond))
+	defer gp.Close()
+
+	// the backoff is longer than the time to live in the queue
+	res := gp.QueueAndWait(&FlakyJob{runs: &runs, failures: 1}, WithQueueTTL(10*time.Millisecond))
+	if res.Err != nil || runs != 2 {
+		t.Fatalf("expected the retry to succeed, got %v after %d runs", res.Err, runs)
+	}
+}
+
+func TestPanicRecovered(t *testing.T) {
+	var runs int32
+	gp := NewPool(1, 1)
+	r := gp.QueueAndWait(&FlakyJob{runs: &runs, failures: 1, panics: true})
+	pe, ok := r.Err.(*PanicError)
+	if !ok || pe.Value != "flaky" || len(pe.Stack) == 0 {
+		t.Fatalf("expected a PanicError, got %v", r.Err)
+	}
+	gp.Close()
+	if s := gp.Stats(); s.Panicked != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	var runs int32
+	gp := NewPool(1, 1,
+		WithRetries(1, time.Millisecond),
+		WithDeadLetters(NewMemoryDeadLetterStore()))
+	defer gp.Close()
+
+	r := gp.QueueAndWait(&FlakyJob{runs: &runs, failures: 3, panics: true})
+	if _, ok := r.Err.(*PanicError); !ok {
+		t.Fatalf("expected a PanicError, got %v", r.Err)
+	}
+	list, err := gp.DeadLetters()
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected a dead letter, got %v, %v", list, err)
+	}
+	dl, err := gp.InspectDeadLetter(list[0].ID)
+	if err != nil || len(dl.Errors) != 2 || dl.Errors[0] != "simpool: job panicked: flaky" {
+		t.Fatalf("unexpected dead letter %+v, %v", dl, err)
+	}
+
+	if err := gp.RequeueDeadLetter(dl.ID); err != nil {
+		t.Fatal(err)
+	}
+	gp.Wait()
+	if atomic.LoadInt32(&runs) != 4 {
+		t.Fatalf("expected the requeued job to succeed, got %v runs", runs)
+	}
+	if list, _ := gp.DeadLetters(); len(list) != 0 {
+		t.Fatalf("expected no dead letters, got %v", list)
+	}
+
+	gp.QueueAndWait(&FlakyJob{runs: new(int32), failures: 3})
+	gp.QueueAndWait(&FlakyJob{runs: new(int32), failures: 3})
+	if err := gp.PurgeDeadLetters(); err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := gp.DeadLetters(); len(list) != 0 {
+		t.Fatalf("expected no dead letters, got %v", list)
+	}
+	if s := gp.Stats(); s.DeadLettered != 3 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestRequeueDeadLetterFull(t *testing.T) {
+	var runs int32
+	gp := NewPool(1, 1,
+		WithOverflowPolicy(OverflowReject),
+		WithDeadLetters(NewMemoryDeadLetterStore()))
+	gp.QueueAndWait(&FlakyJob{runs: &runs, failures: 1})
+	list, _ := gp.DeadLetters()
+	if len(list) != 1 {
+		t.Fatalf("expected a dead letter, got %v", list)
+	}
+
+	gate := make(chan struct{})
+	fillPool(gp, gate)
+	if err := gp.RequeueDeadLetter(list[0].ID); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	// the job is not lost
+	if _, err := gp.InspectDeadLetter(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	close(gate)
+	gp.Wait()
+	if err := gp.RequeueDeadLetter(list[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	gp.Close()
+	if atomic.LoadInt32(&runs) != 2 {
+		t.Fatalf("expected the requeued job to succeed, got %v runs", runs)
+	}
+	if list, _ := gp.DeadLetters(); len(list) != 0 {
+		t.Fatalf("expected no dead letters, got %v", list)
+	}
+}
+
+func TestFileDeadLetterStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dlq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := newTestRegistry(t)
+	store, err := OpenFileDeadLetterStore(dir, reg.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Add(&DeadLetter{Job: &TableJob{"orders", 1}, Errors: []string{"duplicate key"}})
+	store.Add(&DeadLetter{Job: &TableJob{"users", 2}, Errors: []string{"timeout"}})
+	store.Add(&DeadLetter{Job: &SleepJob{}, Errors: []string{"not registered"}})
+	if err := store.Remove(2); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenFileDeadLetterStore(dir, reg.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	list, _ := store.List()
+	if len(list) != 2 || list[0].ID != 1 || list[1].ID != 3 {
+		t.Fatalf("unexpected dead letters %+v", list)
+	}
+	if tj, ok := list[0].Job.(*TableJob); !ok || tj.Table != "orders" || list[0].Errors[0] != "duplicate key" {
+		t.Fatalf("unexpected dead letter %+v", list[0])
+	}
+	if list[1].Job != nil {
+		t.Fatalf("expected an unregistered job to be left out, got %+v", list[1].Job)
+	}
+	if _, err := store.Get(2); err != ErrDeadLetterNotFound {
+		t.Fatalf("expected ErrDeadLetterNotFound, got %v", err)
+	}
+
+	dl := &DeadLetter{Job: &TableJob{"items", 3}}
+	store.Add(dl)
+	if dl.ID != 4 {
+		t.Fatalf("expected ids to go on, got %v", dl.ID)
+	}
+}
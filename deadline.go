@@ -0,0 +1,24 @@
+package simpool
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeadlineMissed is delivered when the job is dropped because its deadline has passed before it started
+var ErrDeadlineMissed = errors.New("simpool: job deadline missed")
+
+// WithEDF schedules jobs earliest-deadline-first by the deadline set by WithDeadline.
+// if 'dropLate' is true, a job whose deadline has passed by the time a worker
+// picks it up is dropped with ErrDeadlineMissed instead of being executed.
+func WithEDF(dropLate bool) Option {
+	return func(p *Pool) {
+		p.queue = NewDeadlineQueue()
+		p.dropLate = dropLate
+	}
+}
+
+// late reports whether the job can no longer meet its deadline
+func (e *internalJob) late(now time.Time) bool {
+	return !e.Deadline.IsZero() && now.After(e.Deadline)
+}
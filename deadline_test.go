@@ -0,0 +1,50 @@
+package simpool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEDFDropsLateJobs(t *testing.T) {
+	var mu sync.Mutex
+	var order []int
+	gate := make(chan struct{})
+	gp := NewPool(1, 10, WithEDF(true))
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	now := time.Now()
+	gp.Queue(&PriorityJob{&mu, &order, 3}, WithDeadline(now.Add(3*time.Second)))
+	gp.Queue(&PriorityJob{&mu, &order, 1}, WithDeadline(now.Add(time.Second)))
+	gp.Queue(&PriorityJob{&mu, &order, 2}, WithDeadline(now.Add(2*time.Second)))
+
+	res := make(chan *JobResult, 1)
+	go func() {
+		res <- gp.QueueAndWait(&PriorityJob{&mu, &order, 0}, WithDeadline(now.Add(10*time.Millisecond)))
+	}()
+	time.Sleep(30 * time.Millisecond)
+	close(gate)
+
+	if r := <-res; r == nil || r.Err != ErrDeadlineMissed {
+		t.Fatalf("expected ErrDeadlineMissed, got %v", r)
+	}
+	gp.Close()
+
+	if !equalInts(order, []int{1, 2, 3}) {
+		t.Fatalf("unexpected order %v", order)
+	}
+	if s := gp.Stats(); s.DeadlineDropped != 1 || s.DeadlineMissed != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestDeadlineMissed(t *testing.T) {
+	gp := NewPool(1, 10)
+	gp.QueueAndWait(&SleepJob{20 * time.Millisecond}, WithDeadline(time.Now().Add(time.Millisecond)))
+	gp.Close()
+	if s := gp.Stats(); s.DeadlineMissed != 1 || s.Completed != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,63 @@
+package simpool
+
+import "sync"
+
+// flight is a job with a dedupe key which is queued or running
+type flight struct {
+	waiters []*internalJob // jobs coalesced into the flight
+}
+
+// flights coalesces jobs with the same dedupe key
+type flights struct {
+	mu sync.Mutex
+	m  map[string]*flight
+}
+
+// WithDedupeKey coalesces the job with a job of the same dedupe key which is
+// already queued or running. the job runs only once and every waiter gets
+// the same JobResult.
+func WithDedupeKey(key string) SubmitOption {
+	return func(j *internalJob) {
+		j.dedupeKey = key
+	}
+}
+
+// join attaches the job to the flight of its dedupe key.
+// it returns false if there is none, and the job becomes the flight.
+func (f *flights) join(j *internalJob) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if fl, ok := f.m[j.dedupeKey]; ok {
+		fl.waiters = append(fl.waiters, j)
+		return true
+	}
+	if f.m == nil {
+		f.m = make(map[string]*flight)
+	}
+	fl := &flight{}
+	f.m[j.dedupeKey] = fl
+	key := j.dedupeKey
+	j.addOnFinish(func(res *JobResult) {
+		f.mu.Lock()
+		delete(f.m, key)
+		f.mu.Unlock()
+		for _, w := range fl.waiters {
+			w.finish(res)
+		}
+	})
+	return false
+}
+
+// addOnFinish adds a function called with the outcome of the job
+func (e *internalJob) addOnFinish(fn func(res *JobResult)) {
+	prev := e.onFinish
+	if prev == nil {
+		e.onFinish = fn
+		return
+	}
+	e.onFinish = func(res *JobResult) {
+		prev(res)
+		fn(res)
+	}
+}
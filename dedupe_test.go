@@ -0,0 +1,65 @@
+package simpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type ExpensiveJob struct {
+	cnt  *int32
+	gate chan struct{}
+}
+
+func (s *ExpensiveJob) Execute() *JobResult {
+	atomic.AddInt32(s.cnt, 1)
+	<-s.gate
+	return &JobResult{Res: "expensive"}
+}
+
+func TestDedupeKey(t *testing.T) {
+	var cnt int32
+	gate := make(chan struct{})
+	gp := NewPool(4, 10)
+
+	first := make(chan *JobResult, 1)
+	go func() {
+		first <- gp.QueueAndWait(&ExpensiveJob{&cnt, gate}, WithDedupeKey("report"))
+	}()
+	for atomic.LoadInt32(&cnt) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*JobResult, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			results[n] = gp.QueueAndWait(&ExpensiveJob{&cnt, gate}, WithDedupeKey("report"))
+		}(i)
+	}
+	for gp.Stats().Coalesced != 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	wg.Wait()
+
+	r := <-first
+	for _, res := range results {
+		if res != r {
+			t.Fatalf("expected the same result, got %v and %v", res, r)
+		}
+	}
+	if cnt != 1 {
+		t.Fatalf("expected a single execution, got %v", cnt)
+	}
+
+	// a new flight once the previous one has finished
+	gp.QueueAndWait(&ExpensiveJob{&cnt, gate}, WithDedupeKey("report"))
+	gp.Close()
+	if cnt != 2 {
+		t.Fatalf("expected a second execution, got %v", cnt)
+	}
+}
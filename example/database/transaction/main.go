@@ -10,7 +10,7 @@ import (
 	"time"
 
 	_ "github.com/lib/pq"
-	"github.com/wonksing/simpool"
+	"github.com/wonksing/simpool/sqldbutils"
 )
 
 const (
@@ -27,65 +27,6 @@ const (
 	DBNamDst = "test"
 )
 
-type InsertJob struct {
-	db   *sql.Tx
-	col1 string
-	col2 string
-}
-
-func NewInsertJob(db *sql.Tx, col1, col2 string) *InsertJob {
-	return &InsertJob{
-		db:   db,
-		col1: col1,
-		col2: col2,
-	}
-}
-
-func (s *InsertJob) Execute() *simpool.JobResult {
-	_, err := s.db.Exec("insert into dst(col1, col2) values($1, $2)", s.col1, s.col2)
-	if err != nil {
-		return &simpool.JobResult{
-			Res: nil,
-			Err: err,
-		}
-	}
-	return &simpool.JobResult{
-		Res: 1,
-	}
-}
-
-// func (s *InsertJob) Execute() *simpool.JobResult {
-// 	tx, err := s.db.Begin()
-// 	if err != nil {
-// 		return &simpool.JobResult{
-// 			Res: nil,
-// 			Err: err,
-// 		}
-// 	}
-// 	defer tx.Rollback()
-
-// 	_, err = tx.Exec("insert into dst(col1, col2) values($1, $2)", s.col1, s.col2)
-// 	// qry := fmt.Sprintf("insert into src(col1, col2) values('%v', '%v')", s.col1, s.col2)
-// 	// _, err := s.db.Exec(qry)
-// 	if err != nil {
-// 		return &simpool.JobResult{
-// 			Res: nil,
-// 			Err: err,
-// 		}
-// 	}
-// 	err = tx.Commit()
-// 	if err != nil {
-// 		tx.Rollback()
-// 		return &simpool.JobResult{
-// 			Res: nil,
-// 			Err: err,
-// 		}
-// 	}
-// 	return &simpool.JobResult{
-// 		Res: 1,
-// 	}
-// }
-
 type SomeModel struct {
 	Col1 string
 	Col2 string
@@ -152,6 +93,7 @@ var (
 	maxQueueSize int
 	cleanup      bool
 	numTests     int
+	batchSize    int
 )
 
 func init() {
@@ -159,6 +101,7 @@ func init() {
 	flag.IntVar(&maxQueueSize, "q", 5000, "max queue size")
 	flag.BoolVar(&cleanup, "c", true, "cleanup test db?")
 	flag.IntVar(&numTests, "n", 10000, "number of tests")
+	flag.IntVar(&batchSize, "b", 1000, "rows per transaction")
 	flag.Parse()
 	runtime.GOMAXPROCS(runtime.NumCPU())
 }
@@ -216,20 +159,22 @@ func main() {
 
 	log.Printf("Start queueing(%v)\n", time.Now())
 
-	// insert into destination using simpool
-	gp := simpool.NewPool(numWorkers, maxQueueSize)
+	// insert into destination using simpool.
+	// each worker owns its transaction and commits every 'batchSize' rows.
+	loader := sqldbutils.NewTxLoader(DBDst, numWorkers, maxQueueSize, batchSize)
 	start := time.Now()
-	tx, _ := DBDst.Begin()
 	for _, v := range list {
-		job := NewInsertJob(tx, v.Col1, v.Col2)
-		gp.Queue(job)
+		loader.Load("insert into dst(col1, col2) values($1, $2)", v.Col1, v.Col2)
 	}
 	log.Printf("Finished queueing(%v)\n", time.Now())
-	gp.Close() // wait for all jobs to finish and return
-	err = tx.Commit()
+	results, err := loader.Close() // wait for all rows and commit the last batches together
 	if err != nil {
-		tx.Rollback()
-		log.Printf("Commit error, %v", err)
+		log.Printf("Load error, %v", err)
+	}
+	for _, r := range results {
+		if !r.Committed {
+			log.Printf("worker %v batch %v rolled back %v rows: %v", r.Worker, r.Seq, r.Rows, r.Err)
+		}
 	}
 	elapsed := time.Since(start)
 	en := int(elapsed / time.Second)
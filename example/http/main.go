@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/wonksing/simpool"
@@ -23,13 +27,25 @@ func init() {
 	flag.IntVar(&maxQueueSize, "q", 320, "max queue size")
 	flag.Parse()
 }
+
+// longJobHnadler streams the progress of the job and then its result
 func longJobHnadler(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		log.Fatalln(err)
 	}
 	job := NewLongJob(body)
-	jr := gp.QueueAndWait(job)
+	f := gp.Submit(job)
+	w.Header().Set("X-Job-Id", strconv.FormatUint(f.ID(), 10))
+
+	flusher, _ := w.(http.Flusher)
+	for pr := range f.Progress() {
+		fmt.Fprintf(w, "%3.0f%% %v\n", pr.Percent, pr.Message)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	jr := f.Result()
 	if jr.Err != nil {
 		log.Println(jr.Err)
 		return
@@ -37,11 +53,31 @@ func longJobHnadler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(jr.Res.(string)))
 }
 
+// statusHandler returns the status of the job of the id
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	status, err := gp.Inspect(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":       status.ID,
+		"state":    status.State.String(),
+		"progress": status.Progress,
+	})
+}
+
 func main() {
 	gp = simpool.NewPool(numWorkers, maxQueueSize)
 
 	router := http.NewServeMux()
 	router.HandleFunc("/longjob", longJobHnadler)
+	router.HandleFunc("/status", statusHandler)
 
 	server := &http.Server{
 		Addr:         addr,
@@ -68,11 +104,26 @@ func NewLongJob(body []byte) *LongJob {
 	}
 }
 func (s *LongJob) Execute() *simpool.JobResult {
+	return s.ExecuteContext(context.Background())
+}
+
+func (s *LongJob) ExecuteContext(ctx context.Context) *simpool.JobResult {
 	log.Println("Executing Long Job")
 
 	bodyStr := string(s.body)
-	// rn := rand.Intn(100)
-	time.Sleep(time.Second * time.Duration(6))
+	steps := 6
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-ctx.Done():
+			return &simpool.JobResult{Err: ctx.Err()}
+		case <-time.After(time.Second):
+		}
+		simpool.ReportProgress(ctx, simpool.Progress{
+			Percent:   float64(100 * i / steps),
+			Processed: int64(i),
+			Message:   fmt.Sprintf("step %v of %v", i, steps),
+		})
+	}
 
 	log.Println("Finished Long Job")
 
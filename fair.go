@@ -0,0 +1,137 @@
+package simpool
+
+// fairClass is the queue of a single class in the fair queue
+type fairClass struct {
+	weight     float64
+	items      []*QueuedJob
+	tags       []float64 // virtual finish time of each item
+	lastFinish float64
+}
+
+// FairQueue is a weighted fair queue.
+// each class gets throughput in proportion to its weight while it has jobs queued.
+// a job is tagged with a virtual finish time when it is queued and
+// the job with the smallest tag runs next.
+type FairQueue struct {
+	weights map[string]float64
+	classes map[string]*fairClass
+	vtime   float64
+	size    int
+}
+
+// NewFairQueue create weighted fair queue across classes set by WithClass.
+// 'weights' maps a class to its weight and a class which is not in 'weights'
+// has a weight of 1.
+func NewFairQueue(weights map[string]int) *FairQueue {
+	q := &FairQueue{
+		weights: make(map[string]float64),
+		classes: make(map[string]*fairClass),
+	}
+	for class, w := range weights {
+		if w > 0 {
+			q.weights[class] = float64(w)
+		}
+	}
+	return q
+}
+
+// WithFairQueue schedules jobs by weighted fair queuing.
+// it is a shorthand for WithQueue(NewFairQueue(weights)).
+func WithFairQueue(weights map[string]int) Option {
+	return WithQueue(NewFairQueue(weights))
+}
+
+// WithClass sets the class, such as a tenant, the job is scheduled under
+// when the pool uses a FairQueue
+func WithClass(class string) SubmitOption {
+	return func(j *internalJob) {
+		j.Class = class
+	}
+}
+
+// Push adds a job to its class
+func (q *FairQueue) Push(j *QueuedJob) {
+	c, ok := q.classes[j.Class]
+	if !ok {
+		w, ok := q.weights[j.Class]
+		if !ok {
+			w = 1
+		}
+		c = &fairClass{weight: w}
+		q.classes[j.Class] = c
+	}
+	start := c.lastFinish
+	if q.vtime > start {
+		start = q.vtime
+	}
+	c.lastFinish = start + 1/c.weight
+	c.items = append(c.items, j)
+	c.tags = append(c.tags, c.lastFinish)
+	q.size++
+}
+
+// head returns the class whose first job has the smallest tag
+func (q *FairQueue) head() (string, *fairClass) {
+	var name string
+	var min *fairClass
+	for n, c := range q.classes {
+		if min == nil || c.tags[0] < min.tags[0] || (c.tags[0] == min.tags[0] && n < name) {
+			name, min = n, c
+		}
+	}
+	return name, min
+}
+
+// Pop removes the job with the smallest tag
+func (q *FairQueue) Pop() *QueuedJob {
+	name, c := q.head()
+	if c == nil {
+		return nil
+	}
+	j := c.items[0]
+	q.vtime = c.tags[0]
+	c.items[0] = nil
+	c.items = c.items[1:]
+	c.tags = c.tags[1:]
+	q.size--
+	q.forget(name, c)
+	return j
+}
+
+// Evict drops the job with the largest tag, which is the last queued job
+// of the class furthest ahead of its fair share
+func (q *FairQueue) Evict() *QueuedJob {
+	var name string
+	var max *fairClass
+	for n, c := range q.classes {
+		if max == nil || c.lastFinish > max.lastFinish {
+			name, max = n, c
+		}
+	}
+	if max == nil {
+		return nil
+	}
+	last := len(max.items) - 1
+	j := max.items[last]
+	max.items[last] = nil
+	max.items = max.items[:last]
+	max.tags = max.tags[:last]
+	if last > 0 {
+		max.lastFinish = max.tags[last-1]
+	}
+	q.size--
+	q.forget(name, max)
+	return j
+}
+
+// forget removes an empty class. an empty class has no backlog to be fair to.
+func (q *FairQueue) forget(name string, c *fairClass) {
+	if len(c.items) == 0 {
+		delete(q.classes, name)
+	}
+}
+
+// Len returns the number of queued jobs
+func (q *FairQueue) Len() int {
+	return q.size
+}
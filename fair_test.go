@@ -0,0 +1,63 @@
+package simpool
+
+import (
+	"sync"
+	"testing"
+)
+
+type ClassJob struct {
+	mu    *sync.Mutex
+	order *[]string
+	class string
+}
+
+func (s *ClassJob) Execute() *JobResult {
+	s.mu.Lock()
+	*s.order = append(*s.order, s.class)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestFairQueueWeights(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	gate := make(chan struct{})
+	gp := NewPool(1, 100, WithFairQueue(map[string]int{"gold": 3}))
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	for i := 0; i < 40; i++ {
+		gp.Queue(&ClassJob{&mu, &order, "gold"}, WithClass("gold"))
+		gp.Queue(&ClassJob{&mu, &order, "bronze"}, WithClass("bronze"))
+	}
+	close(gate)
+	gp.Close()
+
+	cnt := make(map[string]int)
+	for _, c := range order[:40] {
+		cnt[c]++
+	}
+	if cnt["gold"] != 30 || cnt["bronze"] != 10 {
+		t.Fatalf("expected 3:1 share, got %v", cnt)
+	}
+}
+
+func TestFairQueueEvict(t *testing.T) {
+	q := NewFairQueue(nil)
+	q.Push(&QueuedJob{Class: "a"})
+	q.Push(&QueuedJob{Class: "a"})
+	q.Push(&QueuedJob{Class: "b"})
+
+	if j := q.Evict(); j.Class != "a" {
+		t.Fatalf("expected the backlogged class to be evicted, got %v", j.Class)
+	}
+	if q.Len() != 2 {
+		t.Fatalf("expected 2 jobs, got %v", q.Len())
+	}
+	q.Pop()
+	q.Pop()
+	if q.Pop() != nil || len(q.classes) != 0 {
+		t.Fatal("expected an empty queue")
+	}
+}
@@ -0,0 +1,455 @@
+package simpool
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJournalClosed is returned when the journal is used after Close
+var ErrJournalClosed = errors.New("simpool: journal closed")
+
+// PersistentJob is a Job which can be written to a Journal.
+// the options the job was queued with are not written.
+type PersistentJob interface {
+	Job
+	// JobType names the type of the job for the JobDecoder
+	JobType() string
+	// MarshalBinary encodes the job
+	MarshalBinary() ([]byte, error)
+}
+
+// JobDecoder rebuilds a job from its type and the data written by MarshalBinary
+type JobDecoder func(jobType string, data []byte) (Job, error)
+
+// FsyncPolicy decides when the journal flushes its writes to disk
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs after every record. nothing is lost in a crash.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncInterval syncs every JournalOptions.FsyncInterval.
+	// records written since the last sync may be lost if the machine crashes.
+	FsyncInterval
+	// FsyncNever leaves syncing to the operating system. records may be
+	// lost if the machine crashes, but not if only the process does.
+	FsyncNever
+)
+
+const (
+	recordEnqueue byte = 1
+	recordDone    byte = 2
+
+	journalExt = ".wal"
+
+	defaultSegmentSize   = 64 << 20
+	defaultFsyncInterval = time.Second
+)
+
+// JournalOptions configures a Journal
+type JournalOptions struct {
+	Fsync         FsyncPolicy
+	FsyncInterval time.Duration // defaults to a second
+	SegmentSize   int64         // a new segment starts beyond it. defaults to 64MB
+	Decode        JobDecoder    // rebuilds PersistentJob to replay
+
+	// Codec writes the jobs of types registered in its Registry
+	// which are not PersistentJob, and rebuilds them to replay
+	Codec Codec
+
+	// OnError is called when the completion of a job cannot be written.
+	// the job is replayed as unfinished the next time the journal is opened.
+	OnError func(id uint64, err error)
+}
+
+// Journal is a write-ahead log of PersistentJob queued into a Pool.
+// it records when a job is queued and when it is finished, so that
+// the jobs unfinished when the process stopped can be replayed.
+// segments which only hold finished jobs are compacted away.
+type Journal struct {
+	dir  string
+	opts JournalOptions
+
+	mu     sync.Mutex
+	f      *os.File
+	w      *bufio.Writer
+	seq    uint64 // sequence of the active segment
+	size   int64  // bytes written to the active segment since it started
+	total  int64  // bytes in every segment
+	kept   int64  // bytes of the records of the unfinished jobs
+	nextID uint64
+	live   map[uint64]*record // unfinished jobs
+	dirty  bool
+	closed bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// OpenJournal opens the journal in 'dir', creating it if needed
+func OpenJournal(dir string, opts JournalOptions) (*Journal, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.FsyncInterval <= 0 {
+		opts.FsyncInterval = defaultFsyncInterval
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	j := &Journal{
+		dir:  dir,
+		opts: opts,
+		live: make(map[uint64]*record),
+	}
+	seqs, err := listSegments(dir, journalExt)
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		err := readSegment(segmentName(dir, seq, journalExt), func(r *record) error {
+			switch r.kind {
+			case recordEnqueue:
+				j.live[r.id] = r
+			case recordDone:
+				delete(j.live, r.id)
+			}
+			if r.id >= j.nextID {
+				j.nextID = r.id + 1
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		j.seq = seq
+	}
+	if j.nextID == 0 {
+		j.nextID = 1
+	}
+
+	// always start a new segment, a torn record may end the last one
+	if err := j.compact(); err != nil {
+		return nil, err
+	}
+	if opts.Fsync == FsyncInterval {
+		j.stop = make(chan struct{})
+		j.done = make(chan struct{})
+		go j.syncLoop()
+	}
+	return j, nil
+}
+
+// WithJournal records every PersistentJob queued into the pool in the journal.
+// call ReplayJournal after NewPool to queue the jobs left unfinished.
+func WithJournal(j *Journal) Option {
+	return func(p *Pool) {
+		p.journal = j
+	}
+}
+
+// ReplayJournal queues the jobs the journal has not seen finish, in the order
+// they were first queued. it returns the number of jobs queued.
+func (p *Pool) ReplayJournal() (int, error) {
+	if p.journal == nil {
+		return 0, nil
+	}
+	pending := p.journal.unfinished()
+	n := 0
+	for _, r := range pending {
+		job, err := p.journal.decode(r)
+		if err != nil {
+			return n, fmt.Errorf("simpool: decode journal job %v: %w", r.id, err)
+		}
+		e := newInternalJob(job, false, nil)
+		e.journalID = r.id
+		p.journal.track(e)
+		p.submit(e)
+		n++
+	}
+	return n, nil
+}
+
+// record writes the job to the journal if it is a PersistentJob
+// or its type is registered in the journal's codec
+func (p *Pool) record(e *internalJob) error {
+	if p.journal == nil || e.journalID != 0 {
+		return nil
+	}
+	jobType, data, err := p.journal.encode(e.Job)
+	if err != nil || data == nil {
+		return err
+	}
+	id, err := p.journal.append(jobType, data)
+	if err != nil {
+		return err
+	}
+	e.journalID = id
+	p.journal.track(e)
+	return nil
+}
+
+// encode returns the type and the data of the job to write.
+// the data is nil if the job is not to be written.
+// the type is empty for a job written with the codec.
+func (j *Journal) encode(job Job) (string, []byte, error) {
+	if pj, ok := job.(PersistentJob); ok {
+		data, err := pj.MarshalBinary()
+		if err == nil && data == nil {
+			data = []byte{}
+		}
+		return pj.JobType(), data, err
+	}
+	if j.opts.Codec == nil {
+		return "", nil, nil
+	}
+	data, err := j.opts.Codec.Encode(job)
+	if errors.Is(err, ErrJobNotRegistered) {
+		return "", nil, nil
+	}
+	return "", data, err
+}
+
+// decode rebuilds a job to replay
+func (j *Journal) decode(r *record) (Job, error) {
+	if r.jobType == "" && j.opts.Codec != nil {
+		return j.opts.Codec.Decode(r.data)
+	}
+	if j.opts.Decode == nil {
+		return nil, errors.New("simpool: journal has no decoder")
+	}
+	return j.opts.Decode(r.jobType, r.data)
+}
+
+// track writes the completion of the job once it is finished
+func (j *Journal) track(e *internalJob) {
+	e.journal = j
+}
+
+// unfinished returns the unfinished jobs in the order they were queued
+func (j *Journal) unfinished() []*record {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	list := make([]*record, 0, len(j.live))
+	for _, r := range j.live {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].id < list[b].id })
+	return list
+}
+
+// append writes a queued job and returns its id
+func (j *Journal) append(jobType string, data []byte) (uint64, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return 0, ErrJournalClosed
+	}
+	r := &record{kind: recordEnqueue, id: j.nextID, jobType: jobType, data: data}
+	if err := j.write(r); err != nil {
+		return 0, err
+	}
+	j.nextID++
+	j.live[r.id] = r
+	j.kept += recordSize(r)
+	return r.id, j.rotate()
+}
+
+// finish writes the completion of a job
+func (j *Journal) finish(id uint64) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return ErrJournalClosed
+	}
+	if err := j.write(&record{kind: recordDone, id: id}); err != nil {
+		return err
+	}
+	if r, ok := j.live[id]; ok {
+		j.kept -= recordSize(r)
+		delete(j.live, id)
+	}
+	return j.rotate()
+}
+
+// write appends the record to the active segment. 'j.mu' must be held.
+func (j *Journal) write(r *record) error {
+	n, err := writeRecord(j.w, r)
+	if err != nil {
+		return err
+	}
+	j.size += int64(n)
+	j.total += int64(n)
+	// the record is handed to the operating system right away so that it
+	// survives a crash of the process. syncing it to disk follows the policy.
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	j.dirty = true
+	if j.opts.Fsync == FsyncAlways {
+		return j.sync()
+	}
+	return nil
+}
+
+// rotate starts a new segment once the active segment is full.
+// the journal is compacted instead if most of its bytes are of finished
+// jobs, so that every unfinished job is rewritten only once the journal
+// has grown by as much. it is called after 'j.live' is up to date. 'j.mu' must be held.
+func (j *Journal) rotate() error {
+	if j.size < j.opts.SegmentSize {
+		return nil
+	}
+	if j.total >= 2*j.kept {
+		return j.compact()
+	}
+	if err := j.sync(); err != nil {
+		return err
+	}
+	if err := j.f.Close(); err != nil {
+		return err
+	}
+	return j.create()
+}
+
+// create starts a new active segment. 'j.mu' must be held.
+func (j *Journal) create() error {
+	j.seq++
+	f, err := os.OpenFile(segmentName(j.dir, j.seq, journalExt), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j.f = f
+	j.w = bufio.NewWriter(f)
+	j.size = 0
+	return nil
+}
+
+// recordSize returns the bytes the record takes in a segment
+func recordSize(r *record) int64 {
+	return int64(recordHeaderSize + 11 + len(r.jobType) + len(r.data))
+}
+
+// sync flushes the active segment to disk. 'j.mu' must be held.
+func (j *Journal) sync() error {
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	if j.opts.Fsync != FsyncNever {
+		if err := j.f.Sync(); err != nil {
+			return err
+		}
+	}
+	j.dirty = false
+	return nil
+}
+
+func (j *Journal) syncLoop() {
+	defer close(j.done)
+	t := time.NewTicker(j.opts.FsyncInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-t.C:
+			j.mu.Lock()
+			if j.dirty && !j.closed {
+				j.sync()
+			}
+			j.mu.Unlock()
+		}
+	}
+}
+
+// Compact starts a new segment holding only the unfinished jobs
+// and removes the older segments
+func (j *Journal) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return ErrJournalClosed
+	}
+	return j.compact()
+}
+
+// compact starts a new segment with the unfinished jobs and removes
+// the older ones. 'j.mu' must be held.
+func (j *Journal) compact() error {
+	if j.f != nil {
+		if err := j.sync(); err != nil {
+			return err
+		}
+		if err := j.f.Close(); err != nil {
+			return err
+		}
+	}
+	old, err := listSegments(j.dir, journalExt)
+	if err != nil {
+		return err
+	}
+
+	if err := j.create(); err != nil {
+		return err
+	}
+
+	// the rewritten records do not count toward the next rotation
+	j.total = 0
+	ids := make([]uint64, 0, len(j.live))
+	for id := range j.live {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	for _, id := range ids {
+		n, err := writeRecord(j.w, j.live[id])
+		if err != nil {
+			return err
+		}
+		j.total += int64(n)
+	}
+	j.kept = j.total
+	// the new segment must be durable before the old ones go away
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		return err
+	}
+	j.dirty = false
+
+	for _, seq := range old {
+		if err := os.Remove(segmentName(j.dir, seq, journalExt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the journal
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return nil
+	}
+	j.closed = true
+	err := j.sync()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.mu.Unlock()
+
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+	return err
+}
@@ -0,0 +1,234 @@
+package simpool
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+type CopyJob struct {
+	table string
+	mu    *sync.Mutex
+	done  *[]string
+	gate  chan struct{}
+}
+
+func (s *CopyJob) JobType() string {
+	return "copy"
+}
+
+func (s *CopyJob) MarshalBinary() ([]byte, error) {
+	return []byte(s.table), nil
+}
+
+func (s *CopyJob) Execute() *JobResult {
+	if s.gate != nil {
+		<-s.gate
+	}
+	s.mu.Lock()
+	*s.done = append(*s.done, s.table)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	var done []string
+	jr, err := OpenJournal(dir, JournalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{})
+	gp := NewPool(1, 10, WithJournal(jr))
+	gp.QueueAndWait(&CopyJob{"a", &mu, &done, nil})
+	gp.Queue(&CopyJob{"b", &mu, &done, gate})
+	gp.Queue(&CopyJob{"c", &mu, &done, gate})
+	gp.Queue(&SleepJob{}) // not persistent
+	// crash while "b" and "c" are unfinished
+	jr.Close()
+	close(gate)
+	gp.Close()
+
+	done = nil
+	jr, err = OpenJournal(dir, JournalOptions{
+		Decode: func(jobType string, data []byte) (Job, error) {
+			return &CopyJob{string(data), &mu, &done, nil}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gp = NewPool(1, 10, WithJournal(jr))
+	n, err := gp.ReplayJournal()
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 jobs replayed, got %v, %v", n, err)
+	}
+	gp.Close()
+	if len(done) != 2 || done[0] != "b" || done[1] != "c" {
+		t.Fatalf("unexpected replay %v", done)
+	}
+	if len(jr.unfinished()) != 0 {
+		t.Fatal("expected every job finished")
+	}
+	jr.Close()
+}
+
+func TestJournalCompaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jr, err := OpenJournal(dir, JournalOptions{Fsync: FsyncNever, SegmentSize: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var done []string
+	gp := NewPool(4, 10, WithJournal(jr))
+	for i := 0; i < 200; i++ {
+		gp.Queue(&CopyJob{"table", &mu, &done, nil})
+	}
+	gp.Close()
+
+	seqs, err := listSegments(dir, journalExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a few segments may be left since the last compaction
+	if len(seqs) > 4 {
+		t.Fatalf("expected old segments to be removed, got %v", seqs)
+	}
+	jr.Close()
+}
+
+func TestRecordTornTail(t *testing.T) {
+	var buf bytes.Buffer
+	writeRecord(&buf, &record{kind: recordEnqueue, id: 1, jobType: "copy", data: []byte("a")})
+	writeRecord(&buf, &record{kind: recordEnqueue, id: 2, jobType: "copy", data: []byte("b")})
+	torn := buf.Bytes()[:buf.Len()-1]
+
+	br := bufio.NewReader(bytes.NewReader(torn))
+	r, err := readRecord(br)
+	if err != nil || r.id != 1 || string(r.data) != "a" {
+		t.Fatalf("unexpected record %v, %v", r, err)
+	}
+	if _, err := readRecord(br); err != errCorruptRecord {
+		t.Fatalf("expected errCorruptRecord, got %v", err)
+	}
+}
+
+func TestJournalRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jr, err := OpenJournal(dir, JournalOptions{Fsync: FsyncNever, SegmentSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2000; i++ {
+		if _, err := jr.append("copy", []byte("table")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// unfinished jobs are not rewritten on every rotation
+	seqs, err := listSegments(dir, journalExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seqs) < 10 {
+		t.Fatalf("expected the journal to rotate to new segments, got %v", seqs)
+	}
+	jr.Close()
+
+	jr, err = OpenJournal(dir, JournalOptions{Fsync: FsyncNever, SegmentSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(jr.unfinished()); n != 2000 {
+		t.Fatalf("expected 2000 unfinished jobs, got %d", n)
+	}
+	jr.Close()
+}
+
+func TestJournalFlushesRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	jr, err := OpenJournal(dir, JournalOptions{Fsync: FsyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jr.Close()
+	if _, err := jr.append("copy", []byte("table")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the record is in the file without a sync or Close
+	seqs, err := listSegments(dir, journalExt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, seq := range seqs {
+		readSegment(segmentName(dir, seq, journalExt), func(r *record) error {
+			n++
+			return nil
+		})
+	}
+	if n != 1 {
+		t.Fatalf("expected the record written to the file, got %d records", n)
+	}
+}
+
+func TestJournalOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	failed := make(chan error, 1)
+	jr, err := OpenJournal(dir, JournalOptions{
+		Fsync: FsyncNever,
+		OnError: func(id uint64, err error) {
+			failed <- err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{})
+	var mu sync.Mutex
+	var done []string
+	gp := NewPool(1, 1, WithJournal(jr))
+	gp.Queue(&CopyJob{"table", &mu, &done, gate})
+	jr.Close()
+	close(gate)
+	gp.Close()
+
+	select {
+	case err := <-failed:
+		if err != ErrJournalClosed {
+			t.Fatalf("expected ErrJournalClosed, got %v", err)
+		}
+	default:
+		t.Fatal("expected the failed completion reported")
+	}
+}
@@ -0,0 +1,192 @@
+package simpool
+
+import (
+	"sync"
+	"time"
+)
+
+// keyState tracks the jobs of a single key
+type keyState struct {
+	active  int            // jobs of the key queued or running
+	pending []*internalJob // jobs waiting for the key to allow them
+	bucket  *tokenBucket
+	timer   bool // a timer is armed to wake the key up
+}
+
+// keyLimiter enforces per-key concurrency and rate limits.
+// a job which its key does not allow yet is parked instead of queued,
+// so that it occupies neither a worker nor a slot in the queue.
+type keyLimiter struct {
+	mu        sync.Mutex
+	maxActive int
+	rate      float64
+	burst     int
+	keys      map[string]*keyState
+}
+
+func newKeyLimiter(maxActive int, rate float64, burst int) *keyLimiter {
+	return &keyLimiter{
+		maxActive: maxActive,
+		rate:      rate,
+		burst:     burst,
+		keys:      make(map[string]*keyState),
+	}
+}
+
+// WithKeyLimit limits jobs queued with WithKey.
+// at most 'maxConcurrency' jobs of a key are queued or running at once,
+// and if 'rate' is greater than zero, at most 'rate' jobs of a key start per second.
+// a 'maxConcurrency' of zero or less means unlimited.
+func WithKeyLimit(maxConcurrency int, rate float64, burst int) Option {
+	return func(p *Pool) {
+		p.keys = newKeyLimiter(maxConcurrency, rate, burst)
+	}
+}
+
+// WithKey sets the key of the job, such as a tenant or a destination host
+func WithKey(key string) SubmitOption {
+	return func(j *internalJob) {
+		j.key = key
+	}
+}
+
+// admit reports whether the job can be queued now.
+// otherwise the job is parked until its key allows it.
+func (l *keyLimiter) admit(p *Pool, key string, j *internalJob) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ks, ok := l.keys[key]
+	if !ok {
+		ks = &keyState{bucket: newTokenBucket(l.rate, l.burst)}
+		l.keys[key] = ks
+	}
+	if len(ks.pending) == 0 && l.ready(p, key, ks) {
+		ks.active++
+		return true
+	}
+	ks.pending = append(ks.pending, j)
+	p.pending.Add(1)
+	return false
+}
+
+// ready reports whether one more job of the key can start and takes a token if so.
+// a timer is armed when the key is rate limited. 'l.mu' must be held.
+func (l *keyLimiter) ready(p *Pool, key string, ks *keyState) bool {
+	if l.maxActive > 0 && ks.active >= l.maxActive {
+		return false
+	}
+	wait := ks.bucket.take(time.Now())
+	if wait == 0 {
+		return true
+	}
+	if !ks.timer {
+		ks.timer = true
+		time.AfterFunc(wait, func() {
+			l.wake(p, key)
+		})
+	}
+	return false
+}
+
+// next pops the next parked job which can start. 'l.mu' must be held.
+func (l *keyLimiter) next(p *Pool, key string, ks *keyState) *internalJob {
+	if len(ks.pending) == 0 || !l.ready(p, key, ks) {
+		return nil
+	}
+	j := ks.pending[0]
+	ks.pending[0] = nil
+	ks.pending = ks.pending[1:]
+	ks.active++
+	return j
+}
+
+// cleanup forgets an idle key. 'l.mu' must be held.
+func (l *keyLimiter) cleanup(key string, ks *keyState) {
+	if ks.active == 0 && len(ks.pending) == 0 && !ks.timer && ks.bucket.full(time.Now()) {
+		delete(l.keys, key)
+	}
+}
+
+// done is called when a job of the key has finished.
+// it returns a parked job which can start now, if any.
+func (l *keyLimiter) done(p *Pool, key string) *internalJob {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ks := l.keys[key]
+	ks.active--
+	j := l.next(p, key, ks)
+	l.cleanup(key, ks)
+	return j
+}
+
+// wake queues the parked jobs of a key once its rate limit allows them
+func (l *keyLimiter) wake(p *Pool, key string) {
+	l.mu.Lock()
+	ks := l.keys[key]
+	ks.timer = false
+	var jobs []*internalJob
+	for {
+		j := l.next(p, key, ks)
+		if j == nil {
+			break
+		}
+		jobs = append(jobs, j)
+	}
+	l.cleanup(key, ks)
+	l.mu.Unlock()
+
+	for _, j := range jobs {
+		p.enqueue(j)
+		p.pending.Done()
+	}
+}
+
+// admitKey runs the job through the key limits.
+// it returns false if the job was parked.
+func (p *Pool) admitKey(j *internalJob) bool {
+	if j.key == "" || p.keys == nil || p.keys.admit(p, j.key, j) {
+		return true
+	}
+	p.counters.inc(&p.counters.keyDeferred)
+	return false
+}
+
+// release lets the keys of the finished job start their next parked jobs.
+// every returned job still counts in 'p.pending' and the caller must
+// call 'p.pending.Done' once it has run or queued the job.
+func (p *Pool) release(j *internalJob) []*internalJob {
+	var jobs []*internalJob
+	if j.lane != "" {
+		if n := p.lanes.done(p, j.lane); n != nil {
+			if p.admitKey(n) {
+				jobs = append(jobs, n)
+			} else {
+				// parked again by its key, which counts it on its own
+				p.pending.Done()
+			}
+		}
+	}
+	if j.key != "" && p.keys != nil {
+		if n := p.keys.done(p, j.key); n != nil {
+			jobs = append(jobs, n)
+		}
+	}
+	return jobs
+}
+
+// enqueueParked queues a released job without blocking the caller
+func (p *Pool) enqueueParked(j *internalJob) {
+	go func() {
+		p.enqueue(j)
+		p.pending.Done()
+	}()
+}
+
+// releaseAsync queues the parked jobs the keys of the finished job let start
+func (p *Pool) releaseAsync(j *internalJob) {
+	for _, n := range p.release(j) {
+		p.enqueueParked(n)
+	}
+}
@@ -0,0 +1,62 @@
+package simpool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyLimitConcurrency(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(4, 100, WithKeyLimit(2, 0, 0))
+
+	noisy := make([]*GateJob, 10)
+	for i := range noisy {
+		noisy[i] = NewGateJob("noisy", gate)
+		gp.Queue(noisy[i], WithKey("noisy"))
+	}
+	<-noisy[0].started
+	<-noisy[1].started
+
+	var cnt int32
+	r := gp.QueueAndWait(&CountJob{&cnt}, WithKey("quiet"))
+	if r != nil || cnt != 1 {
+		t.Fatalf("expected the quiet key to run, got %v", r)
+	}
+	select {
+	case <-noisy[2].started:
+		t.Fatal("the noisy key exceeded its concurrency limit")
+	default:
+	}
+	if s := gp.Stats(); s.KeyDeferred != 8 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	close(gate)
+	gp.Close()
+	if s := gp.Stats(); s.Completed != 11 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if len(gp.keys.keys) != 0 {
+		t.Fatalf("expected idle keys to be forgotten, got %v", gp.keys.keys)
+	}
+}
+
+func TestKeyLimitRate(t *testing.T) {
+	var cnt int32
+	gp := NewPool(4, 100, WithKeyLimit(0, 100, 1))
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		gp.Queue(&CountJob{&cnt}, WithKey("a"))
+		gp.Queue(&CountJob{&cnt}, WithKey("b"))
+	}
+	gp.Close()
+	elapsed := time.Since(start)
+
+	if cnt != 12 {
+		t.Fatalf("expected 12 jobs, got %v", cnt)
+	}
+	// 5 jobs of each key after the first one at 100 per second
+	if elapsed < 40*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Fatalf("unexpected elapsed %v", elapsed)
+	}
+}
@@ -0,0 +1,116 @@
+package simpool
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type OrderJob struct {
+	mu   *sync.Mutex
+	seen map[string][]int
+	key  string
+	seq  int
+}
+
+func (s *OrderJob) Execute() *JobResult {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+	s.mu.Lock()
+	s.seen[s.key] = append(s.seen[s.key], s.seq)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestOrderingKey(t *testing.T) {
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	gp := NewPool(8, 16)
+
+	numKeys := 5
+	numJobs := 50
+	for i := 0; i < numJobs; i++ {
+		for k := 0; k < numKeys; k++ {
+			key := strconv.Itoa(k)
+			gp.Queue(&OrderJob{&mu, seen, key, i}, WithOrderingKey(key))
+		}
+	}
+	gp.Close()
+
+	for k, seqs := range seen {
+		if len(seqs) != numJobs {
+			t.Fatalf("key %v: expected %v jobs, got %v", k, numJobs, len(seqs))
+		}
+		for i, n := range seqs {
+			if i != n {
+				t.Fatalf("key %v: out of order %v", k, seqs)
+			}
+		}
+	}
+}
+
+func TestOrderingKeyDoesNotBlockWorkers(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(2, 10)
+	first := NewGateJob("first", gate)
+	gp.Queue(first, WithOrderingKey("busy"))
+	<-first.started
+	for i := 0; i < 5; i++ {
+		gp.Queue(NewGateJob("next", gate), WithOrderingKey("busy"))
+	}
+
+	var cnt int32
+	if r := gp.QueueAndWait(&CountJob{&cnt}, WithOrderingKey("idle")); r != nil || cnt != 1 {
+		t.Fatalf("expected the idle key to run, got %v", r)
+	}
+	close(gate)
+	gp.Close()
+
+	if s := gp.Stats(); s.LaneDeferred != 5 || s.Completed != 7 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+// NameJob records its name when it runs
+type NameJob struct {
+	mu    *sync.Mutex
+	names *[]string
+	name  string
+}
+
+func (s *NameJob) Execute() *JobResult {
+	s.mu.Lock()
+	*s.names = append(*s.names, s.name)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestOrderingKeyDoesNotStarveOthers(t *testing.T) {
+	var mu sync.Mutex
+	var names []string
+	gate := make(chan struct{})
+	gp := NewPool(1, 10)
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	gp.Queue(&NameJob{&mu, &names, "A1"}, WithOrderingKey("a"))
+	gp.Queue(&NameJob{&mu, &names, "B1"})
+	for i := 2; i <= 5; i++ {
+		gp.Queue(&NameJob{&mu, &names, "A" + strconv.Itoa(i)}, WithOrderingKey("a"))
+	}
+	close(gate)
+	gp.Close()
+
+	// the jobs released by the key queue up behind B1
+	want := []string{"A1", "B1", "A2", "A3", "A4", "A5"}
+	if len(names) != len(want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, names)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package simpool
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"strconv"
+)
+
+// NestedPolicy decides how a job waits for a job it queued into its own pool
+// with QueueAndWait, so that the pool does not deadlock when every
+// worker is waiting for a job which has no worker to run it
+type NestedPolicy int
+
+const (
+	// NestedHelp queues the child job and lets the waiting worker run
+	// queued jobs until the child is finished. a child which finds the
+	// queue full runs on the waiting worker's goroutine.
+	NestedHelp NestedPolicy = iota
+	// NestedInline runs the child job on the waiting worker's goroutine
+	// right away, skipping the queue and the key limits
+	NestedInline
+)
+
+// String returns the name of the policy
+func (n NestedPolicy) String() string {
+	switch n {
+	case NestedHelp:
+		return "help"
+	case NestedInline:
+		return "inline"
+	}
+	return "unknown"
+}
+
+type poolKey struct{}
+
+// WithNestedPolicy sets how QueueAndWait runs a job queued from a job
+// of the same pool. NestedHelp is the default.
+func WithNestedPolicy(policy NestedPolicy) Option {
+	return func(p *Pool) {
+		p.nested = policy
+	}
+}
+
+// WithParent tells QueueAndWait that it is called by the ContextJob
+// running with 'ctx', the context the job was given, which saves looking
+// up the calling worker. it has no effect on Queue and Submit.
+func WithParent(ctx context.Context) SubmitOption {
+	return func(j *internalJob) {
+		j.parent = ctx
+	}
+}
+
+// QueueAndWaitContext is QueueAndWait with WithParent(ctx)
+func (p *Pool) QueueAndWaitContext(ctx context.Context, job Job, opts ...SubmitOption) *JobResult {
+	return p.QueueAndWait(job, append(opts[:len(opts):len(opts)], WithParent(ctx))...)
+}
+
+// caller returns the worker of the pool running on the calling goroutine,
+// or nil if the caller is not one of its workers
+func (p *Pool) caller() *worker {
+	id := goid()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, w := range p.workers {
+		if w != nil && w.goid == id {
+			return w
+		}
+	}
+	return nil
+}
+
+// goid returns the id of the calling goroutine, from the header of its stack
+func goid() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	// goroutine 18 [running]:
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// waitNested queues the job of a job running in the pool on 'w' and waits for it.
+// 'w' is nil for a job running on the caller's goroutine.
+func (p *Pool) waitNested(j *internalJob, w *worker) *JobResult {
+	j.nested = true
+	p.counters.inc(&p.counters.nested)
+
+	// the jobs run meanwhile get the caller's worker and its resource
+	if w != nil {
+		w.helping++
+		defer func() { w.helping-- }()
+	}
+	j.waiter = w
+	if p.nested == NestedInline {
+		p.counters.inc(&p.counters.submitted)
+		p.jobs.add(j)
+		if !p.lookup(j) {
+			j.Cost = p.cost(j)
+			p.run(j, w)
+		}
+		return <-j.resChan
+	}
+	p.submit(j)
+	return p.help(j, w)
+}
+
+// help runs queued jobs on the caller's goroutine until the job is finished
+func (p *Pool) help(j *internalJob, w *worker) *JobResult {
+	for {
+		select {
+		case res := <-j.resChan:
+			return res
+		default:
+		}
+
+		p.mu.Lock()
+		if p.queue.Len() > 0 && !p.paused {
+			e := p.pop()
+			p.notFull.Broadcast()
+			p.mu.Unlock()
+			p.run(e, w)
+			continue
+		}
+		if p.helpers == nil {
+			p.helpers = make(chan struct{})
+		}
+		wake := p.helpers
+		p.mu.Unlock()
+
+		select {
+		case res := <-j.resChan:
+			return res
+		case <-wake:
+		}
+	}
+}
+
+// wakeHelpers tells the jobs waiting in help that a job is queued. 'p.mu' must be held.
+func (p *Pool) wakeHelpers() {
+	if p.helpers != nil {
+		close(p.helpers)
+		p.helpers = nil
+	}
+}
@@ -0,0 +1,229 @@
+package simpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TreeJob counts the leaves of a binary tree by queuing a job per child
+type TreeJob struct {
+	gp    *Pool
+	depth int
+}
+
+func (s *TreeJob) Execute() *JobResult {
+	return s.ExecuteContext(context.Background())
+}
+
+func (s *TreeJob) ExecuteContext(ctx context.Context) *JobResult {
+	if s.depth == 0 {
+		return &JobResult{Res: 1}
+	}
+	sum := 0
+	for i := 0; i < 2; i++ {
+		r := s.gp.QueueAndWaitContext(ctx, &TreeJob{s.gp, s.depth - 1})
+		if r.Err != nil {
+			return r
+		}
+		sum += r.Res.(int)
+	}
+	return &JobResult{Res: sum}
+}
+
+func TestNestedSubmission(t *testing.T) {
+	for _, policy := range []NestedPolicy{NestedHelp, NestedInline} {
+		gp := NewPool(2, 1, WithNestedPolicy(policy))
+		done := make(chan *JobResult, 1)
+		go func() {
+			done <- gp.QueueAndWait(&TreeJob{gp, 6})
+		}()
+		select {
+		case r := <-done:
+			if r.Res != 64 {
+				t.Fatalf("%v: expected 64 leaves, got %+v", policy, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: nested submission deadlocked", policy)
+		}
+		gp.Close()
+		if s := gp.Stats(); s.Nested != 126 || s.Completed != 127 {
+			t.Fatalf("%v: unexpected stats %+v", policy, s)
+		}
+	}
+}
+
+// PlainTreeJob is TreeJob without a context to pass
+type PlainTreeJob struct {
+	gp    *Pool
+	depth int
+}
+
+func (s *PlainTreeJob) Execute() *JobResult {
+	if s.depth == 0 {
+		return &JobResult{Res: 1}
+	}
+	sum := 0
+	for i := 0; i < 2; i++ {
+		r := s.gp.QueueAndWait(&PlainTreeJob{s.gp, s.depth - 1})
+		if r.Err != nil {
+			return r
+		}
+		sum += r.Res.(int)
+	}
+	return &JobResult{Res: sum}
+}
+
+func TestNestedPlainJob(t *testing.T) {
+	for _, policy := range []NestedPolicy{NestedHelp, NestedInline} {
+		gp := NewPool(2, 1, WithNestedPolicy(policy))
+		done := make(chan *JobResult, 1)
+		go func() {
+			done <- gp.QueueAndWait(&PlainTreeJob{gp, 6})
+		}()
+		select {
+		case r := <-done:
+			if r.Res != 64 {
+				t.Fatalf("%v: expected 64 leaves, got %+v", policy, r)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%v: nested submission deadlocked", policy)
+		}
+		gp.Close()
+		if s := gp.Stats(); s.Nested != 126 {
+			t.Fatalf("%v: unexpected stats %+v", policy, s)
+		}
+	}
+}
+
+func TestNestedOtherPool(t *testing.T) {
+	gp := NewPool(1, 1)
+	defer gp.Close()
+	if r := gp.QueueAndWaitContext(context.Background(), &TreeJob{gp, 0}); r.Res != 1 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	if s := gp.Stats(); s.Nested != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestNestedWorkerResource(t *testing.T) {
+	for _, policy := range []NestedPolicy{NestedHelp, NestedInline} {
+		gp := NewPool(1, 1, WithNestedPolicy(policy), WithWorkerInit(func(worker int) (interface{}, error) {
+			return "conn", nil
+		}))
+		r := gp.QueueAndWait(&ResourceTreeJob{gp, 3})
+		if r.Err != nil || r.Res != 8 {
+			t.Fatalf("%v: unexpected result %+v", policy, r)
+		}
+		gp.Close()
+	}
+}
+
+// ResourceTreeJob is a TreeJob whose leaves need the worker's resource
+type ResourceTreeJob struct {
+	gp    *Pool
+	depth int
+}
+
+func (s *ResourceTreeJob) Execute() *JobResult {
+	return nil
+}
+
+func (s *ResourceTreeJob) ExecuteContext(ctx context.Context) *JobResult {
+	if WorkerResource(ctx) != "conn" {
+		return &JobResult{Err: ErrNoResource}
+	}
+	if s.depth == 0 {
+		return &JobResult{Res: 1}
+	}
+	sum := 0
+	for i := 0; i < 2; i++ {
+		r := s.gp.QueueAndWaitContext(ctx, &ResourceTreeJob{s.gp, s.depth - 1})
+		if r.Err != nil {
+			return r
+		}
+		sum += r.Res.(int)
+	}
+	return &JobResult{Res: sum}
+}
+
+var ErrNoResource = errors.New("no worker resource")
+
+func TestNestedWaitResumes(t *testing.T) {
+	gp := NewPool(1, 1)
+	gate := make(chan struct{})
+	parent := &GatedTreeJob{gp: gp, gate: gate, started: make(chan struct{})}
+	f := gp.Submit(parent)
+	<-parent.started
+	gp.Pause()
+	close(gate) // the parent queues its child while paused
+	time.Sleep(20 * time.Millisecond)
+	gp.Resume()
+	select {
+	case <-f.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested wait hung after Resume")
+	}
+	if r := f.Result(); r.Res != 1 {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	gp.Close()
+}
+
+// GatedTreeJob waits for 'gate' and then for a child job
+type GatedTreeJob struct {
+	gp      *Pool
+	gate    chan struct{}
+	started chan struct{}
+}
+
+func (s *GatedTreeJob) Execute() *JobResult {
+	return nil
+}
+
+func (s *GatedTreeJob) ExecuteContext(ctx context.Context) *JobResult {
+	close(s.started)
+	<-s.gate
+	return s.gp.QueueAndWaitContext(ctx, &TreeJob{s.gp, 0})
+}
+
+// ParentTreeJob is a TreeJob which passes its context with WithParent
+type ParentTreeJob struct {
+	gp    *Pool
+	depth int
+}
+
+func (s *ParentTreeJob) Execute() *JobResult {
+	return nil
+}
+
+func (s *ParentTreeJob) ExecuteContext(ctx context.Context) *JobResult {
+	if s.depth == 0 {
+		return &JobResult{Res: 1}
+	}
+	sum := 0
+	for i := 0; i < 2; i++ {
+		r := s.gp.QueueAndWait(&ParentTreeJob{s.gp, s.depth - 1}, WithParent(ctx))
+		sum += r.Res.(int)
+	}
+	return &JobResult{Res: sum}
+}
+
+func TestQueueAndWaitWithParent(t *testing.T) {
+	gp := NewPool(1, 0)
+	done := make(chan *JobResult, 1)
+	go func() {
+		done <- gp.QueueAndWait(&ParentTreeJob{gp, 4})
+	}()
+	select {
+	case r := <-done:
+		if r.Res != 16 {
+			t.Fatalf("expected 16 leaves, got %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested QueueAndWait deadlocked")
+	}
+	gp.Close()
+}
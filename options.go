@@ -0,0 +1,20 @@
+package simpool
+
+// Option configures a Pool created by NewPool
+type Option func(*Pool)
+
+// WithOverflowPolicy sets what Queue does when the queue is full.
+// OverflowBlock is the default.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(p *Pool) {
+		p.overflow = policy
+	}
+}
+
+// WithDropHandler sets a callback which is called with every job
+// dropped by OverflowDropOldest or OverflowDropNewest
+func WithDropHandler(fn func(job Job)) Option {
+	return func(p *Pool) {
+		p.onDrop = fn
+	}
+}
@@ -0,0 +1,239 @@
+package simpool
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when the job is rejected by OverflowReject
+	ErrQueueFull = errors.New("simpool: queue is full")
+	// ErrJobDropped is delivered when the job is dropped by OverflowDropOldest or OverflowDropNewest
+	ErrJobDropped = errors.New("simpool: job dropped")
+)
+
+// OverflowPolicy decides what happens to a job queued into a full pool
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is room in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowReject rejects the incoming job with ErrQueueFull
+	OverflowReject
+	// OverflowDropOldest drops the oldest queued job to make room for the incoming job
+	OverflowDropOldest
+	// OverflowDropNewest drops the incoming job
+	OverflowDropNewest
+	// OverflowCallerRuns runs the incoming job on the caller's goroutine
+	OverflowCallerRuns
+)
+
+// String returns the name of the policy
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowBlock:
+		return "block"
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowCallerRuns:
+		return "caller-runs"
+	}
+	return "unknown"
+}
+
+// full reports whether the queue has no room for the job.
+// room is counted by the cost of the jobs, and idle workers count
+// as room since they take a job as soon as it is queued, unless paused.
+// so do retired workers, which are started again for the job.
+// a job fits into an empty queue which has any room. 'p.mu' must be held.
+func (p *Pool) full(j *internalJob) bool {
+	room := p.maxQueueSize
+	if !p.paused {
+		room += p.idle + p.noOfWorkers - p.live
+	}
+	if p.queuedCost == 0 {
+		return room <= 0
+	}
+	return p.queuedCost+j.Cost > room
+}
+
+// enqueue puts the job into the queue following the overflow policy.
+// A job which is not queued gets its error delivered to the waiter.
+func (p *Pool) enqueue(j *internalJob) error {
+	p.mu.Lock()
+	if p.trySpill(j) {
+		p.mu.Unlock()
+		return nil
+	}
+	for p.full(j) {
+		switch p.overflow {
+		case OverflowReject:
+			p.mu.Unlock()
+			p.counters.inc(&p.counters.rejected)
+			j.finish(&JobResult{Err: ErrQueueFull})
+			p.releaseAsync(j)
+			return ErrQueueFull
+		case OverflowDropNewest:
+			p.mu.Unlock()
+			p.drop(j)
+			return ErrJobDropped
+		case OverflowCallerRuns:
+			p.mu.Unlock()
+			p.run(j, nil)
+			return nil
+		case OverflowDropOldest:
+			if old := p.queue.Evict(); old != nil {
+				if !p.unlist(old.internal) {
+					// a cancelled job makes no room, but its keys let the jobs behind it go
+					p.mu.Unlock()
+					p.releaseAsync(old.internal)
+					p.mu.Lock()
+					continue
+				}
+				p.mu.Unlock()
+				p.drop(old.internal)
+				p.mu.Lock()
+				continue
+			}
+			fallthrough
+		default:
+			if j.nested {
+				// every worker may be waiting for a job like this one
+				p.mu.Unlock()
+				p.run(j, j.waiter)
+				return nil
+			}
+			p.notFull.Wait()
+		}
+	}
+	p.push(j)
+	if p.idle == 0 {
+		p.spawn()
+	}
+	p.notEmpty.Signal()
+	p.wakeHelpers()
+	p.mu.Unlock()
+	return nil
+}
+
+// dequeue blocks until there is a job to run and the pool is not paused.
+// it returns nil and retires the worker when the pool is closed and
+// nothing is queued or spilled, or when the worker has been idle for the idle timeout.
+func (p *Pool) dequeue(w *worker) *internalJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	since := time.Now()
+	for p.queue.Len() == 0 || p.paused {
+		if p.closed && p.retrying == 0 && p.queue.Len() == 0 && p.onDisk == 0 && p.spilling == 0 {
+			p.retire(w)
+			return nil
+		}
+		p.idle++
+		p.notFull.Broadcast()
+		ok := p.waitIdle(since)
+		p.idle--
+		if !ok {
+			p.retire(w)
+			p.counters.inc(&p.counters.workersRetired)
+			return nil
+		}
+	}
+	e := p.pop()
+	p.notFull.Broadcast()
+	return e
+}
+
+// push puts the job into the queue. 'p.mu' must be held.
+func (p *Pool) push(j *internalJob) {
+	p.queue.Push(&j.QueuedJob)
+	p.queuedCost += j.Cost
+	j.queued = true
+	if !j.StartBy.IsZero() {
+		// the waiter hears of the expiry at the deadline, not when a worker gets to the job
+		j.expiry = time.AfterFunc(time.Until(j.StartBy), func() {
+			p.expire(j)
+		})
+	}
+}
+
+// pop takes the next job out of the queue. 'p.mu' must be held.
+func (p *Pool) pop() *internalJob {
+	e := p.queue.Pop().internal
+	p.unlist(e)
+	return e
+}
+
+// unlist stops counting the job taken out of the queue.
+// it returns false if the job was cancelled while queued. 'p.mu' must be held.
+func (p *Pool) unlist(e *internalJob) bool {
+	if !e.queued {
+		p.dead--
+		return false
+	}
+	e.queued = false
+	p.queuedCost -= e.Cost
+	if e.expiry != nil {
+		e.expiry.Stop()
+		e.expiry = nil
+	}
+	return true
+}
+
+// discount stops counting the job if it is in the queue. it stays there
+// until a worker picks it up and skips it. it returns false if the job
+// is not in the queue. 'p.mu' must be held.
+func (p *Pool) discount(e *internalJob) bool {
+	if !e.queued {
+		return false
+	}
+	p.unlist(e)
+	p.dead++
+	p.notFull.Broadcast()
+	return true
+}
+
+// unqueue stops counting the cancelled job if it is in the queue
+func (p *Pool) unqueue(e *internalJob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discount(e)
+}
+
+// expire finishes the job which is still in the queue at its start deadline
+func (p *Pool) expire(e *internalJob) {
+	p.mu.Lock()
+	queued := p.discount(e)
+	p.mu.Unlock()
+	if queued && e.finish(&JobResult{Err: ErrJobExpired}) {
+		p.counters.inc(&p.counters.expired)
+	}
+}
+
+// queued returns the number of jobs in the queue
+func (p *Pool) queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queue.Len() - p.dead
+}
+
+// queuedCostNow returns the total cost of the jobs in the queue
+func (p *Pool) queuedCostNow() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queuedCost
+}
+
+// drop discards the job
+func (p *Pool) drop(j *internalJob) {
+	p.counters.inc(&p.counters.dropped)
+	if p.onDrop != nil {
+		p.onDrop(j.Job)
+	}
+	j.finish(&JobResult{Err: ErrJobDropped})
+	p.releaseAsync(j)
+}
@@ -0,0 +1,152 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// GateJob blocks until 'gate' is closed
+type GateJob struct {
+	name    string
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func NewGateJob(name string, gate chan struct{}) *GateJob {
+	return &GateJob{
+		name:    name,
+		started: make(chan struct{}),
+		gate:    gate,
+	}
+}
+
+func (s *GateJob) Execute() *JobResult {
+	close(s.started)
+	<-s.gate
+	return &JobResult{Res: s.name}
+}
+
+// fillPool occupies the single worker and the single queue slot
+func fillPool(gp *Pool, gate chan struct{}) (*GateJob, *GateJob) {
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+	queued := NewGateJob("queued", gate)
+	gp.Queue(queued)
+	return running, queued
+}
+
+func TestOverflowReject(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithOverflowPolicy(OverflowReject))
+	fillPool(gp, gate)
+
+	if err := gp.Queue(NewGateJob("rejected", gate)); err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+	r := gp.QueueAndWait(NewGateJob("rejected", gate))
+	if r.Err != ErrQueueFull {
+		t.Fatalf("expected ErrQueueFull, got %v", r.Err)
+	}
+	close(gate)
+	gp.Close()
+
+	s := gp.Stats()
+	if s.Rejected != 2 || s.Completed != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	var dropped []string
+	gate := make(chan struct{})
+	gp := NewPool(1, 1,
+		WithOverflowPolicy(OverflowDropOldest),
+		WithDropHandler(func(job Job) {
+			dropped = append(dropped, job.(*GateJob).name)
+		}))
+	fillPool(gp, gate)
+
+	if err := gp.Queue(NewGateJob("newest", gate)); err != nil {
+		t.Fatal(err)
+	}
+	close(gate)
+	gp.Close()
+
+	if len(dropped) != 1 || dropped[0] != "queued" {
+		t.Fatalf("expected the oldest job to be dropped, got %v", dropped)
+	}
+}
+
+func TestOverflowDropOldestCancelled(t *testing.T) {
+	var cnt, next int32
+	gate := make(chan struct{})
+	gp := NewPool(1, 2, WithOverflowPolicy(OverflowDropOldest))
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	f := gp.Submit(&CountJob{&cnt}, WithOrderingKey("a"))
+	f.Cancel()
+	// parked behind the cancelled job
+	gp.Queue(&CountJob{&next}, WithOrderingKey("a"))
+	gp.Queue(&CountJob{&cnt})
+	gp.Queue(&CountJob{&cnt})
+	gp.Queue(&CountJob{&cnt}) // evicts the cancelled job
+	close(gate)
+
+	closed := make(chan struct{})
+	go func() {
+		gp.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("the job behind the evicted one was never released")
+	}
+	if atomic.LoadInt32(&next) != 1 {
+		t.Fatal("expected the job behind the evicted one to run")
+	}
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithOverflowPolicy(OverflowDropNewest))
+	fillPool(gp, gate)
+
+	r := gp.QueueAndWait(NewGateJob("newest", gate))
+	if r.Err != ErrJobDropped {
+		t.Fatalf("expected ErrJobDropped, got %v", r.Err)
+	}
+	close(gate)
+	gp.Close()
+
+	if s := gp.Stats(); s.Dropped != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+type CountJob struct {
+	cnt *int32
+}
+
+func (s *CountJob) Execute() *JobResult {
+	atomic.AddInt32(s.cnt, 1)
+	return nil
+}
+
+func TestOverflowCallerRuns(t *testing.T) {
+	var cnt int32
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithOverflowPolicy(OverflowCallerRuns))
+	fillPool(gp, gate)
+
+	gp.Queue(&CountJob{&cnt})
+	if atomic.LoadInt32(&cnt) != 1 {
+		t.Fatal("expected the job to run on the caller's goroutine")
+	}
+	close(gate)
+	gp.Close()
+}
@@ -0,0 +1,33 @@
+package simpool
+
+// Pause stops the workers picking up jobs. running jobs finish and
+// jobs are still queued, up to the room in the queue.
+func (p *Pool) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+}
+
+// Resume lets the workers pick up jobs again
+func (p *Pool) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.paused = false
+	// workers may have retired by the idle timeout while paused
+	for i := 0; i < p.queue.Len() && p.live < p.noOfWorkers; i++ {
+		p.spawn()
+	}
+	p.notEmpty.Broadcast()
+	// idle workers count as room again
+	p.notFull.Broadcast()
+	// nested waits which found the pool paused
+	p.wakeHelpers()
+}
+
+// IsPaused reports whether the pool is paused
+func (p *Pool) IsPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.paused
+}
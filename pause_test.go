@@ -0,0 +1,101 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	var cnt int32
+	gate := make(chan struct{})
+	gp := NewPool(1, 10)
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	gp.Pause()
+	if !gp.IsPaused() {
+		t.Fatal("expected the pool to be paused")
+	}
+	for i := 0; i < 5; i++ {
+		gp.Queue(&CountJob{&cnt})
+	}
+	close(gate)
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&cnt); n != 0 {
+		t.Fatalf("expected no job to start while paused, got %v", n)
+	}
+	if s := gp.Stats(); s.Queued != 5 || s.Completed != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	gp.Resume()
+	if gp.IsPaused() {
+		t.Fatal("expected the pool to be resumed")
+	}
+	gp.QueueAndWait(&CountJob{&cnt})
+	gp.Close()
+	if n := atomic.LoadInt32(&cnt); n != 6 {
+		t.Fatalf("expected every job to run, got %v", n)
+	}
+}
+
+func TestCloseResumes(t *testing.T) {
+	var cnt int32
+	gp := NewPool(2, 10)
+	gp.Pause()
+	for i := 0; i < 5; i++ {
+		gp.Queue(&CountJob{&cnt})
+	}
+	gp.Close()
+	if n := atomic.LoadInt32(&cnt); n != 5 {
+		t.Fatalf("expected the queued jobs to run on Close, got %v", n)
+	}
+}
+
+func TestCloseResumesParked(t *testing.T) {
+	var cnt int32
+	gp := NewPool(1, 10)
+	gp.Pause()
+	gp.Queue(&CountJob{&cnt}, WithOrderingKey("k"))
+	gp.Queue(&CountJob{&cnt}, WithOrderingKey("k"))
+	done := make(chan struct{})
+	go func() {
+		gp.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close hung on the parked job")
+	}
+	if n := atomic.LoadInt32(&cnt); n != 2 {
+		t.Fatalf("expected the parked job to run on Close, got %v", n)
+	}
+}
+
+func TestPauseHoldsReleasedJobs(t *testing.T) {
+	var cnt int32
+	gate := make(chan struct{})
+	gp := NewPool(1, 10)
+	running := NewGateJob("running", gate)
+	gp.Queue(running, WithOrderingKey("k"))
+	<-running.started
+	f := gp.Submit(&CountJob{&cnt}, WithOrderingKey("k"))
+
+	gp.Pause()
+	close(gate)
+	time.Sleep(20 * time.Millisecond)
+	if s := f.Status(); s.State != JobQueued || atomic.LoadInt32(&cnt) != 0 {
+		t.Fatalf("expected the released job to wait while paused, got %+v", s)
+	}
+	gp.Resume()
+	if r := f.Result(); r != nil {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	gp.Close()
+	if n := atomic.LoadInt32(&cnt); n != 1 {
+		t.Fatalf("expected the released job to run after Resume, got %v", n)
+	}
+}
@@ -0,0 +1,90 @@
+package simpool
+
+import "context"
+
+// Progress is the progress a running job reports with ReportProgress
+type Progress struct {
+	Percent   float64 // from 0 to 100
+	Processed int64   // items processed so far, such as rows
+	Message   string
+}
+
+type statusKey struct{}
+
+// ReportProgress records the progress of the ContextJob running with 'ctx'.
+// it also counts as a Heartbeat.
+func ReportProgress(ctx context.Context, pr Progress) {
+	Heartbeat(ctx)
+	if s, ok := ctx.Value(statusKey{}).(*jobStatus); ok {
+		s.report(pr)
+	}
+}
+
+// report records the progress and passes it to the watchers
+func (s *jobStatus) report(pr Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != JobRunning {
+		return
+	}
+	s.progress = &pr
+	s.t.counters.inc(&s.t.counters.progressReports)
+	for _, ch := range s.watchers {
+		// the watcher only needs the latest progress
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- pr
+	}
+}
+
+// watch returns a channel receiving the progress of the job
+func (s *jobStatus) watch() <-chan Progress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan Progress, 1)
+	if s.progress != nil {
+		ch <- *s.progress
+	}
+	if s.state != JobQueued && s.state != JobRunning {
+		close(ch)
+		return ch
+	}
+	s.watchers = append(s.watchers, ch)
+	return ch
+}
+
+// Progress returns a channel which receives the latest progress of the job
+// as it is reported, and is closed when the job is finished
+func (f *Future) Progress() <-chan Progress {
+	return f.s.watch()
+}
+
+// running returns the last progress of the running jobs which reported it, by job id
+func (p *Pool) running() map[uint64]Progress {
+	p.mu.Lock()
+	workers := append([]*worker(nil), p.workers...)
+	p.mu.Unlock()
+
+	m := make(map[uint64]Progress)
+	for _, w := range workers {
+		if w == nil {
+			continue
+		}
+		w.mu.Lock()
+		s := w.job
+		w.mu.Unlock()
+		if s == nil {
+			continue
+		}
+		s.mu.Lock()
+		if s.state == JobRunning && s.progress != nil {
+			m[s.id] = *s.progress
+		}
+		s.mu.Unlock()
+	}
+	return m
+}
@@ -0,0 +1,66 @@
+package simpool
+
+import (
+	"context"
+	"testing"
+)
+
+// StepJob reports a step of progress every time 'step' lets it
+type StepJob struct {
+	steps int
+	step  chan struct{}
+}
+
+func (s *StepJob) Execute() *JobResult {
+	return nil
+}
+
+func (s *StepJob) ExecuteContext(ctx context.Context) *JobResult {
+	for i := 1; i <= s.steps; i++ {
+		<-s.step
+		ReportProgress(ctx, Progress{
+			Percent:   float64(100 * i / s.steps),
+			Processed: int64(i),
+			Message:   "copying",
+		})
+	}
+	<-s.step
+	return &JobResult{Res: s.steps}
+}
+
+func TestProgress(t *testing.T) {
+	gp := NewPool(1, 1)
+	defer gp.Close()
+
+	job := &StepJob{steps: 4, step: make(chan struct{})}
+	f := gp.Submit(job)
+	progress := f.Progress()
+	for i := 1; i <= 4; i++ {
+		job.step <- struct{}{}
+		pr := <-progress
+		if pr.Processed != int64(i) || pr.Percent != float64(25*i) || pr.Message != "copying" {
+			t.Fatalf("unexpected progress %+v", pr)
+		}
+	}
+
+	if s := f.Status(); s.Progress == nil || s.Progress.Processed != 4 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	s := gp.Stats()
+	if pr, ok := s.Progress[f.ID()]; !ok || pr.Percent != 100 || s.ProgressReports != 4 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	job.step <- struct{}{}
+	f.Result()
+	if _, ok := <-progress; ok {
+		t.Fatal("expected the progress channel to be closed")
+	}
+	if s := gp.Stats(); len(s.Progress) != 0 {
+		t.Fatalf("expected no running job, got %+v", s.Progress)
+	}
+	// a watcher after the job finished gets the last progress
+	if pr := <-f.Progress(); pr.Processed != 4 {
+		t.Fatalf("unexpected progress %+v", pr)
+	}
+}
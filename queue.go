@@ -0,0 +1,231 @@
+package simpool
+
+import (
+	"container/heap"
+	"time"
+)
+
+// QueuedJob is a job waiting in a JobQueue along with what
+// a scheduling discipline may order it by
+type QueuedJob struct {
+	Job        Job
+	EnqueuedAt time.Time // when the job was queued
+	StartBy    time.Time // the job expires if it has not started by then. zero if none
+	Deadline   time.Time // the job should finish by then. zero if none
+	Priority   int       // a job with a higher priority runs first
+	Class      string    // the class, such as a tenant, the job belongs to
+	Cost       int       // worker slots the job occupies, from 1 to the number of workers
+
+	internal *internalJob
+}
+
+// JobQueue holds the queued jobs of a Pool and decides which one runs next.
+// The pool calls it with its own lock held, so an implementation
+// does not need to be safe for concurrent use.
+type JobQueue interface {
+	// Push adds a job
+	Push(j *QueuedJob)
+	// Pop removes and returns the job to run next, or nil if empty
+	Pop() *QueuedJob
+	// Evict removes and returns the job to drop when OverflowDropOldest
+	// makes room for an incoming job, or nil if empty
+	Evict() *QueuedJob
+	// Len returns the number of queued jobs
+	Len() int
+}
+
+// WithQueue sets the scheduling discipline of the pool. FIFO is the default.
+func WithQueue(q JobQueue) Option {
+	return func(p *Pool) {
+		p.queue = q
+	}
+}
+
+// WithPriority sets the priority of the job for NewPriorityQueue
+func WithPriority(priority int) SubmitOption {
+	return func(j *internalJob) {
+		j.Priority = priority
+	}
+}
+
+// WithDeadline sets the time the job should finish by for NewDeadlineQueue
+func WithDeadline(t time.Time) SubmitOption {
+	return func(j *internalJob) {
+		j.Deadline = t
+	}
+}
+
+// FIFOQueue runs jobs in the order they were queued
+type FIFOQueue struct {
+	items []*QueuedJob
+}
+
+// NewFIFOQueue create first-in first-out queue
+func NewFIFOQueue() *FIFOQueue {
+	return &FIFOQueue{}
+}
+
+// Push adds a job to the back
+func (q *FIFOQueue) Push(j *QueuedJob) {
+	q.items = append(q.items, j)
+}
+
+// Pop removes the job at the front
+func (q *FIFOQueue) Pop() *QueuedJob {
+	if len(q.items) == 0 {
+		return nil
+	}
+	j := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return j
+}
+
+// Evict drops the oldest job, which is the next one to run
+func (q *FIFOQueue) Evict() *QueuedJob {
+	return q.Pop()
+}
+
+// Len returns the number of queued jobs
+func (q *FIFOQueue) Len() int {
+	return len(q.items)
+}
+
+// LIFOQueue runs the most recently queued job first
+type LIFOQueue struct {
+	items []*QueuedJob
+}
+
+// NewLIFOQueue create last-in first-out queue
+func NewLIFOQueue() *LIFOQueue {
+	return &LIFOQueue{}
+}
+
+// Push adds a job to the top
+func (q *LIFOQueue) Push(j *QueuedJob) {
+	q.items = append(q.items, j)
+}
+
+// Pop removes the job at the top
+func (q *LIFOQueue) Pop() *QueuedJob {
+	last := len(q.items) - 1
+	if last < 0 {
+		return nil
+	}
+	j := q.items[last]
+	q.items[last] = nil
+	q.items = q.items[:last]
+	return j
+}
+
+// Evict drops the oldest job, which is at the bottom
+func (q *LIFOQueue) Evict() *QueuedJob {
+	if len(q.items) == 0 {
+		return nil
+	}
+	j := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	return j
+}
+
+// Len returns the number of queued jobs
+func (q *LIFOQueue) Len() int {
+	return len(q.items)
+}
+
+// heapItem keeps the order jobs were pushed to break ties
+type heapItem struct {
+	job *QueuedJob
+	seq uint64
+}
+
+// heapQueue runs jobs in the order of 'less', then in the order they were queued
+type heapQueue struct {
+	items []heapItem
+	seq   uint64
+	less  func(a, b *QueuedJob) bool
+}
+
+func (h *heapQueue) before(a, b heapItem) bool {
+	if h.less(a.job, b.job) {
+		return true
+	}
+	if h.less(b.job, a.job) {
+		return false
+	}
+	return a.seq < b.seq
+}
+
+// heap.Interface. use Push, Pop, Evict and Len of JobQueue from outside.
+type heapItems heapQueue
+
+func (h *heapItems) Len() int           { return len(h.items) }
+func (h *heapItems) Less(i, j int) bool { return (*heapQueue)(h).before(h.items[i], h.items[j]) }
+func (h *heapItems) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *heapItems) Push(x interface{}) { h.items = append(h.items, x.(heapItem)) }
+func (h *heapItems) Pop() interface{} {
+	last := len(h.items) - 1
+	it := h.items[last]
+	h.items[last] = heapItem{}
+	h.items = h.items[:last]
+	return it
+}
+
+// Push adds a job
+func (h *heapQueue) Push(j *QueuedJob) {
+	h.seq++
+	heap.Push((*heapItems)(h), heapItem{job: j, seq: h.seq})
+}
+
+// Pop removes the job which comes first
+func (h *heapQueue) Pop() *QueuedJob {
+	if len(h.items) == 0 {
+		return nil
+	}
+	return heap.Pop((*heapItems)(h)).(heapItem).job
+}
+
+// Evict drops the job which comes last
+func (h *heapQueue) Evict() *QueuedJob {
+	if len(h.items) == 0 {
+		return nil
+	}
+	// the last one is one of the leaves
+	last := len(h.items) / 2
+	for i := last + 1; i < len(h.items); i++ {
+		if h.before(h.items[last], h.items[i]) {
+			last = i
+		}
+	}
+	return heap.Remove((*heapItems)(h), last).(heapItem).job
+}
+
+// Len returns the number of queued jobs
+func (h *heapQueue) Len() int {
+	return len(h.items)
+}
+
+// NewPriorityQueue create queue which runs the job with the highest
+// priority set by WithPriority first. Evict drops the lowest priority job.
+func NewPriorityQueue() JobQueue {
+	return &heapQueue{
+		less: func(a, b *QueuedJob) bool {
+			return a.Priority > b.Priority
+		},
+	}
+}
+
+// NewDeadlineQueue create earliest-deadline-first queue which runs the job
+// with the nearest deadline set by WithDeadline first. jobs without
+// a deadline run after the others. Evict drops the job with the latest deadline.
+func NewDeadlineQueue() JobQueue {
+	return &heapQueue{
+		less: func(a, b *QueuedJob) bool {
+			if a.Deadline.IsZero() || b.Deadline.IsZero() {
+				return !a.Deadline.IsZero() && b.Deadline.IsZero()
+			}
+			return a.Deadline.Before(b.Deadline)
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package simpool
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func popAll(q JobQueue) []int {
+	var res []int
+	for j := q.Pop(); j != nil; j = q.Pop() {
+		res = append(res, j.Priority)
+	}
+	return res
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueueOrder(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		queue   JobQueue
+		evicted int
+		order   []int
+	}{
+		{"fifo", NewFIFOQueue(), 1, []int{2, 3, 4}},
+		{"lifo", NewLIFOQueue(), 1, []int{4, 3, 2}},
+		{"priority", NewPriorityQueue(), 1, []int{4, 3, 2}},
+		{"deadline", NewDeadlineQueue(), 4, []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		for i := 1; i <= 4; i++ {
+			tt.queue.Push(&QueuedJob{
+				Priority: i,
+				Deadline: now.Add(time.Duration(i) * time.Second),
+			})
+		}
+		if j := tt.queue.Evict(); j.Priority != tt.evicted {
+			t.Fatalf("%v: expected %v to be evicted, got %v", tt.name, tt.evicted, j.Priority)
+		}
+		if tt.queue.Len() != 3 {
+			t.Fatalf("%v: expected 3 jobs, got %v", tt.name, tt.queue.Len())
+		}
+		if order := popAll(tt.queue); !equalInts(order, tt.order) {
+			t.Fatalf("%v: expected %v, got %v", tt.name, tt.order, order)
+		}
+	}
+}
+
+func TestDeadlineQueueWithoutDeadline(t *testing.T) {
+	q := NewDeadlineQueue()
+	q.Push(&QueuedJob{Priority: 1})
+	q.Push(&QueuedJob{Priority: 2, Deadline: time.Now().Add(time.Hour)})
+	q.Push(&QueuedJob{Priority: 3})
+	if order := popAll(q); !equalInts(order, []int{2, 1, 3}) {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
+
+type PriorityJob struct {
+	mu    *sync.Mutex
+	order *[]int
+	n     int
+}
+
+func (s *PriorityJob) Execute() *JobResult {
+	s.mu.Lock()
+	*s.order = append(*s.order, s.n)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestPoolWithPriorityQueue(t *testing.T) {
+	var mu sync.Mutex
+	var order []int
+	gate := make(chan struct{})
+	gp := NewPool(1, 10, WithQueue(NewPriorityQueue()))
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	for i := 0; i < 5; i++ {
+		gp.Queue(&PriorityJob{&mu, &order, i}, WithPriority(i))
+	}
+	close(gate)
+	gp.Close()
+
+	if !equalInts(order, []int{4, 3, 2, 1, 0}) {
+		t.Fatalf("unexpected order %v", order)
+	}
+}
@@ -0,0 +1,140 @@
+package simpool
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tokenBucket limits events to 'rate' per second with bursts up to 'burst'.
+// a rate of zero or less means unlimited.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+
+	changed chan struct{} // closed when the rate changes, for the jobs waiting in wait
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{changed: make(chan struct{})}
+	b.set(rate, burst, time.Now())
+	b.tokens = float64(b.burst)
+	return b
+}
+
+// refill adds tokens earned since the last call. 'b.mu' must be held.
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		b.last = now
+	}
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+}
+
+// set changes the rate and the burst keeping the tokens earned so far
+func (b *tokenBucket) set(rate float64, burst int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.rate = rate
+	b.burst = burst
+	if b.burst < 1 {
+		b.burst = 1
+	}
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.wake()
+}
+
+// wake makes the jobs waiting for a token look at the bucket again. 'b.mu' must be held.
+func (b *tokenBucket) wake() {
+	if b.changed != nil {
+		close(b.changed)
+	}
+	b.changed = make(chan struct{})
+}
+
+// wait takes a token, waiting for one if there is none.
+// the wait is worked out again whenever the rate changes.
+// it returns how long it waited.
+func (b *tokenBucket) wait() time.Duration {
+	var waited time.Duration
+	for {
+		b.mu.Lock()
+		changed := b.changed
+		b.mu.Unlock()
+		now := time.Now()
+		wait := b.take(now)
+		if wait <= 0 {
+			return waited
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-changed:
+			t.Stop()
+		}
+		waited += time.Since(now)
+	}
+}
+
+// take takes a token if there is one.
+// otherwise it returns how long to wait for the next token.
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled up to its burst
+func (b *tokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return true
+	}
+	b.refill(now)
+	return b.tokens >= float64(b.burst)
+}
+
+// WithRateLimit caps how many jobs the pool starts per second.
+// up to 'burst' jobs can start at once. a rate of zero or less means unlimited.
+func WithRateLimit(rate float64, burst int) Option {
+	return func(p *Pool) {
+		p.limiter = newTokenBucket(rate, burst)
+	}
+}
+
+// SetRateLimit changes the dispatch rate of a running pool, also for the
+// jobs already waiting for it. a rate of zero or less removes the limit,
+// such as to drain the queue at once while closing.
+func (p *Pool) SetRateLimit(rate float64, burst int) {
+	p.limiter.set(rate, burst, time.Now())
+}
+
+// waitRate blocks until the job is allowed to start
+func (p *Pool) waitRate() {
+	wait := p.limiter.wait()
+	if wait <= 0 {
+		return
+	}
+	p.counters.inc(&p.counters.rateLimited)
+	atomic.AddUint64(&p.counters.rateLimitWait, uint64(wait))
+}
@@ -0,0 +1,111 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	var cnt int32
+	gp := NewPool(8, 100, WithRateLimit(100, 1))
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		gp.Queue(&CountJob{&cnt})
+	}
+	gp.Close()
+	elapsed := time.Since(start)
+
+	// 10 jobs after the first one at 100 per second
+	if elapsed < 90*time.Millisecond {
+		t.Fatalf("rate limit not applied, elapsed %v", elapsed)
+	}
+	s := gp.Stats()
+	if s.RateLimited == 0 || s.RateLimitWait == 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestSetRateLimit(t *testing.T) {
+	b := newTokenBucket(1, 1)
+	now := time.Now()
+	if w := b.take(now); w != 0 {
+		t.Fatalf("expected a token from the burst, waited %v", w)
+	}
+	if w := b.take(now); w < 900*time.Millisecond {
+		t.Fatalf("expected to wait about a second, waited %v", w)
+	}
+	b.set(0, 1, now)
+	if w := b.take(now); w != 0 {
+		t.Fatalf("expected unlimited, waited %v", w)
+	}
+}
+
+func TestSetRateLimitWakes(t *testing.T) {
+	var cnt int32
+	gp := NewPool(1, 10, WithRateLimit(0.1, 1))
+	defer gp.Close()
+	for i := 0; i < 2; i++ {
+		gp.Queue(&CountJob{&cnt})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// the second job is waiting for ten seconds
+	start := time.Now()
+	gp.SetRateLimit(0, 1)
+	for atomic.LoadInt32(&cnt) < 2 {
+		if time.Since(start) > time.Second {
+			t.Fatal("the waiting job did not see the new rate")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCloseRateLimit(t *testing.T) {
+	var cnt int32
+	gp := NewPool(1, 10, WithRateLimit(0.1, 1))
+	for i := 0; i < 3; i++ {
+		gp.Queue(&CountJob{&cnt})
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	// the queue drains at the rate until the limit is removed
+	closed := make(chan struct{})
+	go func() {
+		gp.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close did not wait for the rate limit")
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := atomic.LoadInt32(&cnt); n != 1 {
+		t.Fatalf("expected only the first job run, got %d", n)
+	}
+	gp.SetRateLimit(0, 1)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close waited after the limit was removed")
+	}
+	if atomic.LoadInt32(&cnt) != 3 {
+		t.Fatalf("expected every job run, got %d", cnt)
+	}
+}
+
+func TestRateLimitExpired(t *testing.T) {
+	gp := NewPool(1, 10, WithRateLimit(0.1, 1))
+	defer gp.Close()
+	gp.Queue(&SleepJob{50 * time.Millisecond})
+
+	// expires while the first job runs and does not wait ten seconds for the rate
+	start := time.Now()
+	res := gp.QueueAndWait(&SleepJob{0}, WithQueueTTL(10*time.Millisecond))
+	if res == nil || res.Err != ErrJobExpired {
+		t.Fatalf("expected ErrJobExpired, got %v", res)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the expired job waited for the rate, elapsed %v", elapsed)
+	}
+}
@@ -0,0 +1,90 @@
+package simpool
+
+import "time"
+
+// WithMaxJobsPerWorker retires a worker goroutine after it has run 'n' jobs
+// and starts a new one in its place, which sets up its resource again,
+// see WithWorkerInit. it bounds the leaks of jobs which keep state around.
+func WithMaxJobsPerWorker(n int) Option {
+	return func(p *Pool) {
+		p.maxJobsPerWorker = n
+	}
+}
+
+// WithWorkerIdleTimeout retires a worker goroutine which has waited for a job
+// for 'd'. workers are started again as jobs are queued, up to the number of workers.
+func WithWorkerIdleTimeout(d time.Duration) Option {
+	return func(p *Pool) {
+		p.idleTimeout = d
+	}
+}
+
+// spawn starts a worker in a free slot if there is one. 'p.mu' must be held.
+func (p *Pool) spawn() {
+	if p.live >= p.noOfWorkers {
+		return
+	}
+	for i, w := range p.workers {
+		if w == nil {
+			w = &worker{index: i}
+			p.workers[i] = w
+			p.live++
+			p.wg.Add(1)
+			go p.startWorkers(w)
+			return
+		}
+	}
+}
+
+// retire frees the slot of the worker. 'p.mu' must be held.
+func (p *Pool) retire(w *worker) {
+	p.workers[w.index] = nil
+	p.live--
+}
+
+// recycle retires the worker if it has run its share of jobs
+// and starts a new one in its place
+func (p *Pool) recycle(w *worker) bool {
+	if p.maxJobsPerWorker <= 0 || w.jobs < p.maxJobsPerWorker {
+		return false
+	}
+	// the resource goes away before another worker takes the index
+	p.teardownWorker(w)
+	w.ready = false
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.retire(w)
+	p.spawn()
+	p.counters.inc(&p.counters.workersRetired)
+	return true
+}
+
+// waitIdle waits for a job to be queued. it returns false once
+// the worker has been idle for the idle timeout. 'p.mu' must be held.
+func (p *Pool) waitIdle(since time.Time) bool {
+	if p.idleTimeout <= 0 {
+		p.notEmpty.Wait()
+		return true
+	}
+	left := p.idleTimeout - time.Since(since)
+	if left <= 0 {
+		return false
+	}
+	t := time.AfterFunc(left, func() {
+		p.mu.Lock()
+		p.notEmpty.Broadcast()
+		p.mu.Unlock()
+	})
+	p.notEmpty.Wait()
+	t.Stop()
+	return true
+}
+
+// liveWorkers returns the number of worker goroutines
+func (p *Pool) liveWorkers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.live
+}
@@ -0,0 +1,72 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMaxJobsPerWorker(t *testing.T) {
+	var inits, teardowns, cnt int32
+	gp := NewPool(1, 1,
+		WithMaxJobsPerWorker(2),
+		WithWorkerInit(func(worker int) (interface{}, error) {
+			atomic.AddInt32(&inits, 1)
+			return nil, nil
+		}),
+		WithWorkerTeardown(func(worker int, res interface{}) {
+			atomic.AddInt32(&teardowns, 1)
+		}))
+	for i := 0; i < 5; i++ {
+		gp.QueueAndWait(&CountJob{&cnt})
+	}
+	if s := gp.Stats(); s.Workers != 1 || s.WorkersRetired != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	gp.Close()
+	if inits != 3 || teardowns != 3 || cnt != 5 {
+		t.Fatalf("expected 3 workers to run 5 jobs, got %v inits, %v teardowns, %v jobs", inits, teardowns, cnt)
+	}
+}
+
+func TestWorkerIdleTimeout(t *testing.T) {
+	var cnt int32
+	gp := NewPool(2, 0, WithWorkerIdleTimeout(20*time.Millisecond))
+	time.Sleep(80 * time.Millisecond)
+	if s := gp.Stats(); s.Workers != 0 || s.WorkersRetired != 2 {
+		t.Fatalf("expected idle workers to be retired, got %+v", s)
+	}
+
+	gp.QueueAndWait(&CountJob{&cnt})
+	if s := gp.Stats(); s.Workers != 1 {
+		t.Fatalf("expected a worker to be started, got %+v", s)
+	}
+	for i := 0; i < 10; i++ {
+		gp.Queue(&CountJob{&cnt})
+	}
+	gp.Close()
+	if cnt != 11 {
+		t.Fatalf("expected every job to run, got %v", cnt)
+	}
+	if s := gp.Stats(); s.Workers != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestResumeStartsWorkers(t *testing.T) {
+	var cnt int32
+	gp := NewPool(2, 10, WithWorkerIdleTimeout(20*time.Millisecond))
+	gp.Pause()
+	f := gp.Submit(&CountJob{&cnt})
+	time.Sleep(80 * time.Millisecond)
+	if s := gp.Stats(); s.Workers != 0 {
+		t.Fatalf("expected idle workers to be retired, got %+v", s)
+	}
+	gp.Resume()
+	select {
+	case <-f.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Resume to start a worker for the queued job")
+	}
+	gp.Close()
+}
@@ -0,0 +1,170 @@
+package simpool
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrJobNotRegistered is returned when a job type is not in the Registry
+var ErrJobNotRegistered = errors.New("simpool: job type not registered")
+
+// Codec encodes jobs into envelopes which carry the job type name,
+// and decodes the envelopes back into jobs
+type Codec interface {
+	Encode(job Job) ([]byte, error)
+	Decode(data []byte) (Job, error)
+}
+
+// Registry maps job type names to constructors so that jobs can be
+// persisted, sent between processes or replayed.
+// the fields of a job to keep must be exported.
+type Registry struct {
+	mu    sync.RWMutex
+	ctors map[string]func() Job
+	names map[reflect.Type]string
+}
+
+// NewRegistry create empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		ctors: make(map[string]func() Job),
+		names: make(map[reflect.Type]string),
+	}
+}
+
+// Register adds a job type. 'newJob' returns an empty job,
+// usually a pointer, which an envelope is decoded into.
+func (r *Registry) Register(name string, newJob func() Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.ctors[name]; ok {
+		return fmt.Errorf("simpool: job type %q registered twice", name)
+	}
+	typ := reflect.TypeOf(newJob())
+	if other, ok := r.names[typ]; ok {
+		return fmt.Errorf("simpool: %v already registered as %q", typ, other)
+	}
+	r.ctors[name] = newJob
+	r.names[typ] = name
+	return nil
+}
+
+// Name returns the registered name of the job's type
+func (r *Registry) Name(job Job) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name, ok := r.names[reflect.TypeOf(job)]
+	if !ok {
+		return "", fmt.Errorf("%w: %T", ErrJobNotRegistered, job)
+	}
+	return name, nil
+}
+
+// New returns an empty job of the registered name
+func (r *Registry) New(name string) (Job, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ctor, ok := r.ctors[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrJobNotRegistered, name)
+	}
+	return ctor(), nil
+}
+
+// JSON returns the codec of JSON envelopes, which look like
+//
+//	{"type":"copy","job":{"Table":"orders"}}
+func (r *Registry) JSON() Codec {
+	return jsonCodec{r}
+}
+
+// Gob returns the codec of gob envelopes
+func (r *Registry) Gob() Codec {
+	return gobCodec{r}
+}
+
+type jsonEnvelope struct {
+	Type string          `json:"type"`
+	Job  json.RawMessage `json:"job"`
+}
+
+type jsonCodec struct {
+	r *Registry
+}
+
+func (c jsonCodec) Encode(job Job) ([]byte, error) {
+	name, err := c.r.Name(job)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonEnvelope{Type: name, Job: data})
+}
+
+func (c jsonCodec) Decode(data []byte) (Job, error) {
+	var env jsonEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	job, err := c.r.New(env.Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(env.Job) > 0 {
+		if err := json.Unmarshal(env.Job, job); err != nil {
+			return nil, fmt.Errorf("simpool: decode %q: %w", env.Type, err)
+		}
+	}
+	return job, nil
+}
+
+type gobEnvelope struct {
+	Type string
+	Job  []byte
+}
+
+type gobCodec struct {
+	r *Registry
+}
+
+func (c gobCodec) Encode(job Job) ([]byte, error) {
+	name, err := c.r.Name(job)
+	if err != nil {
+		return nil, err
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(job); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gobEnvelope{Type: name, Job: data.Bytes()}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c gobCodec) Decode(data []byte) (Job, error) {
+	var env gobEnvelope
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&env); err != nil {
+		return nil, err
+	}
+	job, err := c.r.New(env.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(env.Job)).Decode(job); err != nil {
+		return nil, fmt.Errorf("simpool: decode %q: %w", env.Type, err)
+	}
+	return job, nil
+}
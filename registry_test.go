@@ -0,0 +1,110 @@
+package simpool
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+type TableJob struct {
+	Table string
+	Rows  int
+}
+
+var tableJobsMu sync.Mutex
+var tableJobs []string
+
+func (s *TableJob) Execute() *JobResult {
+	tableJobsMu.Lock()
+	tableJobs = append(tableJobs, s.Table)
+	tableJobsMu.Unlock()
+	return &JobResult{Res: s.Rows}
+}
+
+func newTestRegistry(t *testing.T) *Registry {
+	reg := NewRegistry()
+	if err := reg.Register("table", func() Job { return &TableJob{} }); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func TestRegistryCodecs(t *testing.T) {
+	reg := newTestRegistry(t)
+	for name, c := range map[string]Codec{"json": reg.JSON(), "gob": reg.Gob()} {
+		data, err := c.Encode(&TableJob{"orders", 3})
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		job, err := c.Decode(data)
+		if err != nil {
+			t.Fatal(name, err)
+		}
+		tj, ok := job.(*TableJob)
+		if !ok || tj.Table != "orders" || tj.Rows != 3 {
+			t.Fatalf("%s: unexpected job %#v", name, job)
+		}
+	}
+
+	data, _ := reg.JSON().Encode(&TableJob{"orders", 3})
+	if string(data) != `{"type":"table","job":{"Table":"orders","Rows":3}}` {
+		t.Fatalf("unexpected envelope %s", data)
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	reg := newTestRegistry(t)
+	if err := reg.Register("table", func() Job { return &SleepJob{} }); err == nil {
+		t.Fatal("expected a name registered twice to fail")
+	}
+	if err := reg.Register("other", func() Job { return &TableJob{} }); err == nil {
+		t.Fatal("expected a type registered twice to fail")
+	}
+	if _, err := reg.JSON().Encode(&SleepJob{}); !errors.Is(err, ErrJobNotRegistered) {
+		t.Fatalf("expected ErrJobNotRegistered, got %v", err)
+	}
+	if _, err := reg.JSON().Decode([]byte(`{"type":"unknown"}`)); !errors.Is(err, ErrJobNotRegistered) {
+		t.Fatalf("expected ErrJobNotRegistered, got %v", err)
+	}
+}
+
+func TestJournalCodec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := newTestRegistry(t)
+	jr, err := OpenJournal(dir, JournalOptions{Codec: reg.Gob()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{})
+	gp := NewPool(1, 10, WithJournal(jr))
+	gp.Queue(NewGateJob("running", gate)) // not registered
+	gp.Queue(&TableJob{"orders", 1})
+	gp.Queue(&TableJob{"users", 2})
+	// crash while the table jobs are unfinished
+	jr.Close()
+	close(gate)
+	gp.Close()
+
+	tableJobs = nil
+	jr, err = OpenJournal(dir, JournalOptions{Codec: reg.Gob()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer jr.Close()
+	gp = NewPool(1, 10, WithJournal(jr))
+	n, err := gp.ReplayJournal()
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 jobs replayed, got %v, %v", n, err)
+	}
+	gp.Close()
+	if len(tableJobs) != 2 || tableJobs[0] != "orders" || tableJobs[1] != "users" {
+		t.Fatalf("unexpected replay %v", tableJobs)
+	}
+}
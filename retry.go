@@ -0,0 +1,73 @@
+package simpool
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError is the error of a job which panicked
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack of the job's goroutine when it panicked
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("simpool: job panicked: %v", e.Value)
+}
+
+// WithRetries runs a job which fails, returning an error or panicking, up to
+// 'maxRetries' more times. the first retry waits 'backoff' and every
+// next one waits twice as long as the one before.
+func WithRetries(maxRetries int, backoff time.Duration) Option {
+	return func(p *Pool) {
+		p.maxRetries = maxRetries
+		p.backoff = backoff
+	}
+}
+
+// call executes the job, turning a panic into a PanicError
+func (p *Pool) call(e *internalJob, ctx context.Context) (res *JobResult) {
+	defer func() {
+		if v := recover(); v != nil {
+			p.counters.inc(&p.counters.panicked)
+			res = &JobResult{Err: &PanicError{Value: v, Stack: debug.Stack()}}
+		}
+	}()
+	if cj, ok := e.Job.(ContextJob); ok {
+		return cj.ExecuteContext(ctx)
+	}
+	return e.Job.Execute()
+}
+
+// retry records the error of the attempt and queues the job again
+// after its backoff. it returns false when the job has no retries left.
+func (p *Pool) retry(e *internalJob, err error) bool {
+	e.errs = append(e.errs, err.Error())
+	if len(e.errs) > p.maxRetries {
+		return false
+	}
+	p.counters.inc(&p.counters.retried)
+	e.status.requeue(e)
+	// the job has started already, so a backoff past its start deadline
+	// does not expire it
+	e.StartBy = time.Time{}
+
+	// workers stay until the retry is queued even if the pool is closed
+	p.mu.Lock()
+	p.retrying++
+	p.mu.Unlock()
+
+	wait := p.backoff << uint(len(e.errs)-1)
+	time.AfterFunc(wait, func() {
+		e.EnqueuedAt = time.Now()
+		p.enqueue(e)
+
+		p.mu.Lock()
+		p.retrying--
+		p.notEmpty.Broadcast()
+		p.mu.Unlock()
+	})
+	return true
+}
@@ -0,0 +1,132 @@
+package simpool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// errCorruptRecord is returned by readRecord for a torn or damaged record
+var errCorruptRecord = errors.New("simpool: corrupt record")
+
+// a record in a segment file is
+//
+//	length(4) crc32(4) kind(1) id(8) typeLen(2) type data
+//
+// the length and the checksum cover everything after them.
+type record struct {
+	kind    byte
+	id      uint64
+	jobType string
+	data    []byte
+}
+
+const recordHeaderSize = 8
+
+// writeRecord appends the record to 'w' and returns the bytes written
+func writeRecord(w io.Writer, r *record) (int, error) {
+	body := make([]byte, 11+len(r.jobType)+len(r.data))
+	body[0] = r.kind
+	binary.BigEndian.PutUint64(body[1:], r.id)
+	binary.BigEndian.PutUint16(body[9:], uint16(len(r.jobType)))
+	copy(body[11:], r.jobType)
+	copy(body[11+len(r.jobType):], r.data)
+
+	buf := make([]byte, recordHeaderSize+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(body))
+	copy(buf[recordHeaderSize:], body)
+	return w.Write(buf)
+}
+
+// readRecord reads the next record. it returns io.EOF at the end and
+// errCorruptRecord for a record cut short by a crash or damaged.
+func readRecord(r *bufio.Reader) (*record, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errCorruptRecord
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size < 11 {
+		return nil, errCorruptRecord
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, errCorruptRecord
+	}
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errCorruptRecord
+	}
+	typeLen := int(binary.BigEndian.Uint16(body[9:]))
+	if 11+typeLen > len(body) {
+		return nil, errCorruptRecord
+	}
+	return &record{
+		kind:    body[0],
+		id:      binary.BigEndian.Uint64(body[1:]),
+		jobType: string(body[11 : 11+typeLen]),
+		data:    body[11+typeLen:],
+	}, nil
+}
+
+// readSegment calls 'fn' with every record of the segment file.
+// it stops quietly at a torn record at the end of the file.
+func readSegment(path string, fn func(r *record) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	for {
+		r, err := readRecord(br)
+		if err == io.EOF || err == errCorruptRecord {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+// segmentName returns the file name of the segment with the sequence number
+func segmentName(dir string, seq uint64, ext string) string {
+	return filepath.Join(dir, strconv.FormatUint(seq, 10)+ext)
+}
+
+// listSegments returns the sequence numbers of the segments in 'dir' in order
+func listSegments(dir string, ext string) ([]uint64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
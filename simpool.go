@@ -1,10 +1,30 @@
 package simpool
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 type internalJob struct {
-	resChan chan *JobResult
-	job     Job
+	QueuedJob
+	resChan  chan *JobResult
+	onFinish func(res *JobResult) // called with the outcome of the job, whatever it is
+
+	key       string   // jobs with the same key share the key limits
+	lane      string   // jobs with the same ordering key run one at a time in order
+	dedupeKey string   // jobs with the same dedupe key in flight run once
+	journalID uint64   // the id of the job in the journal. zero if not journaled
+	journal   *Journal // writes the completion of the job
+
+	errs   []string        // the errors of the failed attempts, oldest first
+	status *jobStatus      // the id and the state of the job
+	parent context.Context // the context of the job queuing it, see WithParent
+	nested bool            // a job of the same pool is waiting for it
+	queued bool            // in the queue and counted in its cost. guarded by 'p.mu'
+	future bool            // a Future holds the status of the job
+	expiry *time.Timer     // expires the job in the queue at its start deadline. guarded by 'p.mu'
+	waiter *worker         // the worker of the job waiting for the nested job, if any
 }
 
 // Pool struct
@@ -12,18 +32,73 @@ type Pool struct {
 	noOfWorkers  int
 	maxQueueSize int
 	wg           *sync.WaitGroup
-	jobChan      chan *internalJob
+	pending      sync.WaitGroup // jobs parked by key limits
+
+	mu         sync.Mutex
+	notEmpty   *sync.Cond
+	notFull    *sync.Cond
+	queue      JobQueue
+	slots      *slots
+	queuedCost int  // total cost of the queued jobs
+	dead       int  // cancelled jobs still in the queue, which do not count
+	spilling   int  // jobs being written to the spill
+	onDisk     int  // jobs in the spill waiting for room in the queue
+	idle       int  // workers waiting for a job
+	retrying   int  // failed jobs waiting for their backoff
+	paused     bool // workers do not pick up jobs
+	closed     bool // no more jobs are coming once the queue is empty
+
+	workers        []*worker // by index. nil for a retired worker
+	live           int       // worker goroutines
+	workerInit     func(worker int) (interface{}, error)
+	workerTeardown func(worker int, res interface{})
+
+	overflow OverflowPolicy
+	onDrop   func(job Job)
+	dropLate bool
+	codel    *codel
+	limiter  *tokenBucket
+	keys     *keyLimiter
+	lanes    *keyLimiter
+	flights  flights
+	cache    *resultCache
+	journal  *Journal
+	spill    *Spill
+	watchdog *watchdog
+	jobs     *jobTable
+	counters *counters
+
+	maxRetries  int
+	backoff     time.Duration
+	deadLetters DeadLetterStore
+
+	maxJobsPerWorker int
+	idleTimeout      time.Duration
+
+	nested  NestedPolicy
+	helpers chan struct{} // closed when a job is queued, for the jobs waiting in help
 }
 
 // NewPool create pool object
-func NewPool(noOfWorkers int, maxQueueSize int) *Pool {
+func NewPool(noOfWorkers int, maxQueueSize int, opts ...Option) *Pool {
 	var wg sync.WaitGroup
-	jobChan := make(chan *internalJob, maxQueueSize)
 	p := &Pool{
 		noOfWorkers:  noOfWorkers,
 		maxQueueSize: maxQueueSize,
 		wg:           &wg,
-		jobChan:      jobChan,
+		queue:        NewFIFOQueue(),
+		slots:        newSlots(noOfWorkers),
+		limiter:      newTokenBucket(0, 1),
+		lanes:        newKeyLimiter(1, 0, 0),
+		counters:     &counters{},
+	}
+	p.jobs = newJobTable(p.counters)
+	p.jobs.unqueue = p.unqueue
+	p.notEmpty = sync.NewCond(&p.mu)
+	p.notFull = sync.NewCond(&p.mu)
+	p.workers = make([]*worker, noOfWorkers)
+	for _, opt := range opts {
+		opt(p)
 	}
 	p.init()
 	return p
@@ -31,61 +106,265 @@ func NewPool(noOfWorkers int, maxQueueSize int) *Pool {
 
 // Init initializes the pool
 func (p *Pool) init() {
-	if p.jobChan == nil {
-		p.jobChan = make(chan *internalJob, p.maxQueueSize)
-	}
-
-	p.wg.Add(p.noOfWorkers)
+	p.mu.Lock()
+	p.closed = false
 	for i := 0; i < p.noOfWorkers; i++ {
-		go p.startWorkers()
+		p.spawn()
+	}
+	if p.spill != nil {
+		p.wg.Add(1)
+		go p.feed()
 	}
+	p.mu.Unlock()
+	p.startWatchdog()
 }
 
-func (p *Pool) startWorkers() {
+func (p *Pool) startWorkers(w *worker) {
 	defer p.wg.Done()
+	defer p.teardownWorker(w)
+
+	// for QueueAndWait called by the jobs of this worker
+	p.mu.Lock()
+	w.goid = goid()
+	p.mu.Unlock()
 
 	// it is a blocking operation.
 	// wait until a job is received.
-	// break when the 'jobChan' is closed and empty.
-	for e := range p.jobChan {
-		if e != nil {
-			res := e.job.Execute()
-			if e.resChan != nil {
-				// send JobResult to 'resChan'
-				e.resChan <- res
-				close(e.resChan)
-			}
+	// break when the pool is closed and the queue is empty,
+	// or when the worker is retired.
+	for {
+		e := p.dequeue(w)
+		if e == nil {
+			return
+		}
+		if p.codel != nil {
+			now := time.Now()
+			p.codel.observe(now.Sub(e.EnqueuedAt), now)
+		}
+		p.run(e, w)
+		if p.recycle(w) {
+			return
 		}
 	}
 }
 
-// Queue a job into the Pool
-func (p *Pool) Queue(job Job) {
-	j := &internalJob{
-		job: job,
+// run executes the job and queues the parked jobs its keys let start.
+// they are queued behind the jobs already waiting, and on another goroutine
+// so that a busy worker never waits for room in the queue.
+// a worker holds as many slots as the cost of the job while it runs,
+// and a worker waiting for a nested job runs other jobs within them.
+// 'w' is nil when the job runs on the caller's goroutine.
+func (p *Pool) run(e *internalJob, w *worker) {
+	done := true
+	// a job which is not going to run does not wait for the rate or the slots
+	if !p.skip(e) {
+		p.waitRate()
+		if w != nil && w.helping == 0 {
+			p.slots.acquire(e.Cost)
+			done = p.execute(e, w)
+			p.slots.release(e.Cost)
+		} else {
+			done = p.execute(e, w)
+		}
+	}
+	if !done {
+		// the job runs again after its backoff, holding on to its keys
+		return
 	}
-	p.jobChan <- j
+	p.releaseAsync(e)
 }
 
-// QueueAndWait a job into the Pool
-func (p *Pool) QueueAndWait(job Job) *JobResult {
-	j := &internalJob{
-		resChan: make(chan *JobResult, 1),
-		job:     job,
+// skip finishes the job if it was cancelled or it is too late to start it.
+// it returns true if the job is not going to run.
+func (p *Pool) skip(e *internalJob) bool {
+	if e.status.isCancelled() {
+		// finished when it was cancelled, unless it was on disk then
+		e.finish(&JobResult{Err: ErrJobCancelled})
+		return true
+	}
+	now := time.Now()
+	if e.expired(now) {
+		// counted once, whether the worker or the expiry timer got to it first
+		if e.finish(&JobResult{Err: ErrJobExpired}) {
+			p.counters.inc(&p.counters.expired)
+		}
+		return true
+	}
+	if p.dropLate && e.late(now) {
+		p.counters.inc(&p.counters.deadlineDropped)
+		if len(e.errs) > 0 {
+			// a retry which is dropped keeps the errors of its attempts
+			p.bury(e)
+		}
+		e.finish(&JobResult{Err: ErrDeadlineMissed})
+		return true
+	}
+	return false
+}
+
+// execute runs the job and sends JobResult to 'resChan' if there is one.
+// it returns false if the job failed and is going to be retried.
+func (p *Pool) execute(e *internalJob, w *worker) bool {
+	// the job may have become too late while it waited for the rate or the slots
+	if p.skip(e) {
+		return true
+	}
+	if w != nil && !p.setupWorker(w) {
+		// the job fails rather than the worker going away
+		e.finish(&JobResult{Err: w.err})
+		return true
+	}
+	ctx := w.context(context.Background())
+	var cancel context.CancelFunc
+	if _, ok := e.Job.(ContextJob); ok {
+		ctx = context.WithValue(ctx, statusKey{}, e.status)
+		ctx = context.WithValue(ctx, poolKey{}, p)
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+	}
+	if !e.status.start(cancel) {
+		e.finish(&JobResult{Err: ErrJobCancelled})
+		return true
+	}
+	if w != nil {
+		prev, started := w.begin(e.status, time.Now())
+		defer w.end(prev, started, time.Now())
+		w.jobs++
+	}
+	res := p.call(e, ctx)
+	p.counters.inc(&p.counters.completed)
+	if e.late(time.Now()) {
+		p.counters.inc(&p.counters.deadlineMissed)
+	}
+	if res != nil && res.Err != nil && !e.status.isCancelled() {
+		if p.retry(e, res.Err) {
+			return false
+		}
+		p.bury(e)
+	}
+	e.finish(res)
+	return true
+}
+
+// finish delivers the result to the waiter, if any.
+// only the first outcome of the job is delivered, and it returns false
+// if the job had already finished.
+func (e *internalJob) finish(res *JobResult) bool {
+	if e.status != nil {
+		if !e.status.finish(res) {
+			return false
+		}
+		defer e.status.settle()
+	}
+	if e.resChan != nil {
+		e.resChan <- res
+		close(e.resChan)
+	}
+	if e.onFinish != nil {
+		e.onFinish(res)
+	}
+	if e.journal != nil {
+		if err := e.journal.finish(e.journalID); err != nil && e.journal.opts.OnError != nil {
+			e.journal.opts.OnError(e.journalID, err)
+		}
+	}
+	return true
+}
+
+// newInternalJob wraps the job with submit options applied
+func newInternalJob(job Job, wait bool, opts []SubmitOption) *internalJob {
+	j := &internalJob{}
+	j.QueuedJob = QueuedJob{
+		Job:        job,
+		EnqueuedAt: time.Now(),
+		internal:   j,
+	}
+	if wait {
+		j.resChan = make(chan *JobResult, 1)
+	}
+	if cj, ok := job.(CostJob); ok {
+		j.Cost = cj.Cost()
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// submit admits the job and puts it into the queue.
+// A job which is not admitted gets its error delivered to the waiter.
+func (p *Pool) submit(j *internalJob) error {
+	p.counters.inc(&p.counters.submitted)
+	p.jobs.add(j)
+	if p.lookup(j) {
+		return nil
+	}
+	if j.dedupeKey != "" && p.flights.join(j) {
+		p.counters.inc(&p.counters.coalesced)
+		return nil
+	}
+	if err := p.record(j); err != nil {
+		j.finish(&JobResult{Err: err})
+		return err
+	}
+	j.Cost = p.cost(j)
+	if p.codel != nil && p.codel.overloaded(p.queued()) {
+		p.counters.inc(&p.counters.shed)
+		j.finish(&JobResult{Err: ErrOverloaded})
+		return ErrOverloaded
+	}
+	if j.lane != "" && !p.lanes.admit(p, j.lane, j) {
+		// parked until the jobs before it with the same ordering key finish
+		p.counters.inc(&p.counters.laneDeferred)
+		return nil
+	}
+	if !p.admitKey(j) {
+		return nil
+	}
+	return p.enqueue(j)
+}
+
+// Queue a job into the Pool.
+// It returns an error when the job was not accepted by the overflow policy.
+func (p *Pool) Queue(job Job, opts ...SubmitOption) error {
+	j := newInternalJob(job, false, opts)
+	return p.submit(j)
+}
+
+// QueueAndWait a job into the Pool.
+// a job calling it on its own pool waits as NestedPolicy says,
+// so that the pool does not deadlock once every worker is waiting.
+func (p *Pool) QueueAndWait(job Job, opts ...SubmitOption) *JobResult {
+	j := newInternalJob(job, true, opts)
+	if j.parent != nil && j.parent.Value(poolKey{}) == p {
+		w, _ := j.parent.Value(workerKey{}).(*worker)
+		return p.waitNested(j, w)
+	}
+	if w := p.caller(); w != nil {
+		return p.waitNested(j, w)
 	}
-	p.jobChan <- j
+	p.submit(j)
 	return <-j.resChan
 }
 
-// Close workers
+// Close workers. a paused pool is resumed so that the queued jobs run.
 func (p *Pool) Close() {
-	close(p.jobChan)
+	// parked jobs are released only as the jobs ahead of them run
+	p.Resume()
+	p.pending.Wait()
+	p.mu.Lock()
+	p.closed = true
+	p.notEmpty.Broadcast()
+	// the feeder, which waits for room
+	p.notFull.Broadcast()
+	p.wakeHelpers()
+	p.mu.Unlock()
 	p.wg.Wait()
+	p.stopWatchdog()
 }
 
 // Wait for jobs to finish and get ready to receive jobs again
 func (p *Pool) Wait() {
 	p.Close()
-	p.jobChan = nil
 	p.init()
 }
@@ -0,0 +1,361 @@
+package simpool
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrJobLost is delivered to the Future of a spilled job which could not be read back
+var ErrJobLost = errors.New("simpool: spilled job lost")
+
+const (
+	recordSpill byte = 5
+
+	spillExt         = ".spill"
+	spillSegmentSize = 16 << 20
+)
+
+// Spill holds the jobs queued beyond the in-memory queue of a Pool in
+// segment files, and feeds them back to the queue as the workers catch up.
+// jobs are encoded with a Codec, so their types must be registered in its Registry.
+// a Spill is used by a single pool and is not durable, see Journal for that.
+type Spill struct {
+	dir         string
+	codec       Codec
+	segmentSize int64
+
+	mu    sync.Mutex
+	wf    *os.File
+	w     *bufio.Writer
+	wseq  uint64 // the segment being written
+	wsize int64
+	rf    *os.File
+	r     *bufio.Reader
+	rseq  uint64 // the segment being read
+	count int    // jobs on disk
+}
+
+// spilledJob is how a job is written to a Spill
+type spilledJob struct {
+	ID         uint64
+	Job        []byte // the job encoded by the codec
+	EnqueuedAt time.Time
+	StartBy    time.Time
+	Deadline   time.Time
+	Priority   int
+	Class      string
+	Cost       int
+	Key        string
+	Lane       string
+	JournalID  uint64
+	Errs       []string
+}
+
+// OpenSpill opens a spill in 'dir', creating it if needed.
+// segments left by an earlier run are removed.
+func OpenSpill(dir string, codec Codec) (*Spill, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	seqs, err := listSegments(dir, spillExt)
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		if err := os.Remove(segmentName(dir, seq, spillExt)); err != nil {
+			return nil, err
+		}
+	}
+	s := &Spill{dir: dir, codec: codec, segmentSize: spillSegmentSize}
+	if err := s.next(); err != nil {
+		return nil, err
+	}
+	s.rseq = s.wseq
+	return s, nil
+}
+
+// WithSpill writes the jobs queued into a full pool to 's' instead of
+// following the overflow policy. the spilled jobs are queued again in order
+// as room frees up. jobs with a waiter or callbacks, such as the ones
+// queued with QueueAndWait, a dedupe key or a result cache, and jobs
+// whose type is not registered in the codec are not spilled.
+func WithSpill(s *Spill) Option {
+	return func(p *Pool) {
+		p.spill = s
+	}
+}
+
+// next starts a new segment to write
+func (s *Spill) next() error {
+	if s.wf != nil {
+		if err := s.w.Flush(); err != nil {
+			return err
+		}
+		if err := s.wf.Close(); err != nil {
+			return err
+		}
+	}
+	s.wseq++
+	f, err := os.OpenFile(segmentName(s.dir, s.wseq, spillExt), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	s.wf = f
+	s.w = bufio.NewWriter(f)
+	s.wsize = 0
+	return nil
+}
+
+// push writes the job to the end of the spill. it returns ErrJobNotRegistered
+// if the codec cannot encode the job.
+func (s *Spill) push(e *internalJob, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.codec.Encode(e.Job)
+	if err != nil {
+		return err
+	}
+	data, err = json.Marshal(spilledJob{
+		ID:         id,
+		Job:        data,
+		EnqueuedAt: e.EnqueuedAt,
+		StartBy:    e.StartBy,
+		Deadline:   e.Deadline,
+		Priority:   e.Priority,
+		Class:      e.Class,
+		Cost:       e.Cost,
+		Key:        e.key,
+		Lane:       e.lane,
+		JournalID:  e.journalID,
+		Errs:       e.errs,
+	})
+	if err != nil {
+		return err
+	}
+	n, err := writeRecord(s.w, &record{kind: recordSpill, data: data})
+	if err != nil {
+		return err
+	}
+	s.count++
+	s.wsize += int64(n)
+	if s.wsize >= s.segmentSize {
+		return s.next()
+	}
+	return nil
+}
+
+// pop reads the job at the front of the spill and returns it with its id.
+// 'Job' of the returned job is nil and the error is set if the job could not be decoded.
+func (s *Spill) pop() (*internalJob, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.rf == nil {
+			f, err := os.Open(segmentName(s.dir, s.rseq, spillExt))
+			if err != nil {
+				return nil, 0, err
+			}
+			s.rf = f
+			s.r = bufio.NewReader(f)
+		}
+		if s.rseq == s.wseq {
+			// the reader caught up with the writer
+			if err := s.w.Flush(); err != nil {
+				return nil, 0, err
+			}
+		}
+		r, err := readRecord(s.r)
+		if err == io.EOF && s.rseq < s.wseq {
+			s.rf.Close()
+			s.rf = nil
+			os.Remove(segmentName(s.dir, s.rseq, spillExt))
+			s.rseq++
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		s.count--
+		if s.count == 0 {
+			// start over so that the disk space is given back
+			if err := s.reset(); err != nil {
+				return nil, 0, err
+			}
+		}
+		return s.decode(r)
+	}
+}
+
+// reset removes the segments once every job is read. 's.mu' must be held.
+func (s *Spill) reset() error {
+	s.rf.Close()
+	s.rf = nil
+	from, to := s.rseq, s.wseq
+	if err := s.next(); err != nil {
+		return err
+	}
+	s.rseq = s.wseq
+	for seq := from; seq <= to; seq++ {
+		if err := os.Remove(segmentName(s.dir, seq, spillExt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spill) decode(r *record) (*internalJob, uint64, error) {
+	var sj spilledJob
+	if err := json.Unmarshal(r.data, &sj); err != nil {
+		return nil, 0, err
+	}
+	e := &internalJob{
+		key:       sj.Key,
+		lane:      sj.Lane,
+		journalID: sj.JournalID,
+		errs:      sj.Errs,
+	}
+	e.QueuedJob = QueuedJob{
+		EnqueuedAt: sj.EnqueuedAt,
+		StartBy:    sj.StartBy,
+		Deadline:   sj.Deadline,
+		Priority:   sj.Priority,
+		Class:      sj.Class,
+		Cost:       sj.Cost,
+		internal:   e,
+	}
+	job, err := s.codec.Decode(sj.Job)
+	e.Job = job
+	return e, sj.ID, err
+}
+
+// Close removes the segments. call it after the pool is closed.
+func (s *Spill) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rf != nil {
+		s.rf.Close()
+	}
+	if err := s.wf.Close(); err != nil {
+		return err
+	}
+	seqs, err := listSegments(s.dir, spillExt)
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if err := os.Remove(segmentName(s.dir, seq, spillExt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spillable reports whether the job can live on disk for a while
+func (e *internalJob) spillable() bool {
+	return e.resChan == nil && e.onFinish == nil
+}
+
+// trySpill writes the job to the spill if the queue has no room for it,
+// or if earlier jobs are spilled so that the order is kept.
+// it returns false if the job is to be queued as usual.
+// 'p.mu' must be held, and it is let go while the job is written.
+func (p *Pool) trySpill(j *internalJob) bool {
+	if p.spill == nil || !j.spillable() {
+		return false
+	}
+	if p.spilling == 0 && p.onDisk == 0 && !p.full(j) {
+		return false
+	}
+	p.spilling++
+	p.mu.Unlock()
+	// the job may be read back as soon as it is written
+	id := j.status.id
+	p.jobs.spill(j)
+	err := p.spill.push(j, id)
+	if err != nil {
+		p.jobs.reattach(j, id)
+	}
+	p.mu.Lock()
+	p.spilling--
+	if err != nil {
+		return false
+	}
+	p.onDisk++
+	p.counters.inc(&p.counters.spilled)
+	// for the feeder
+	p.notFull.Broadcast()
+	return true
+}
+
+// feed moves spilled jobs back to the queue while there is room, so that
+// the workers never wait for the disk. it returns once the pool is closed
+// and nothing is left on disk.
+func (p *Pool) feed() {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for p.onDisk == 0 || (p.queue.Len() > 0 && p.queuedCost >= p.maxQueueSize) {
+			if p.closed && p.onDisk == 0 && p.spilling == 0 {
+				return
+			}
+			p.notFull.Wait()
+		}
+		p.mu.Unlock()
+		e, id, err := p.spill.pop()
+		p.mu.Lock()
+
+		if e == nil {
+			// the rest of the spill cannot be read. journaled jobs are
+			// left unfinished in the journal to be replayed.
+			atomic.AddUint64(&p.counters.lost, uint64(p.onDisk))
+			p.onDisk = 0
+			p.mu.Unlock()
+			p.jobs.lose()
+			p.mu.Lock()
+			p.notEmpty.Broadcast()
+			continue
+		}
+		p.onDisk--
+		if err != nil {
+			// a journaled job is left unfinished in the journal to be replayed
+			p.counters.inc(&p.counters.dropped)
+			p.jobs.reattach(e, id)
+			go func() {
+				e.finish(&JobResult{Err: err})
+				p.releaseAsync(e)
+			}()
+			continue
+		}
+		if e.journalID != 0 {
+			e.journal = p.journal
+		}
+		p.jobs.reattach(e, id)
+		p.push(e)
+		if p.idle == 0 {
+			p.spawn()
+		}
+		p.notEmpty.Broadcast()
+		p.wakeHelpers()
+	}
+}
+
+// spilled returns the number of jobs on disk
+func (p *Pool) spilled() int {
+	if p.spill == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.onDisk + p.spilling
+}
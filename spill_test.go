@@ -0,0 +1,261 @@
+package simpool
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := newTestRegistry(t)
+	spill, err := OpenSpill(dir, reg.Gob())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spill.segmentSize = 256 // a few jobs per segment
+	gate := make(chan struct{})
+	gp := NewPool(1, 2, WithSpill(spill), WithOverflowPolicy(OverflowReject))
+	fillPool(gp, gate)
+
+	tableJobs = nil
+	for i := 0; i < 100; i++ {
+		if err := gp.Queue(&TableJob{Table: "t", Rows: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := gp.Stats()
+	if s.Spilled != 99 || s.OnDisk != 99 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	segs, _ := listSegments(dir, spillExt)
+	if len(segs) < 2 {
+		t.Fatalf("expected several segments, got %v", segs)
+	}
+
+	close(gate)
+	gp.Close()
+	if len(tableJobs) != 100 {
+		t.Fatalf("expected every job to run, got %v", len(tableJobs))
+	}
+	if s := gp.Stats(); s.OnDisk != 0 || s.Rejected != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	segs, _ = listSegments(dir, spillExt)
+	if len(segs) != 1 {
+		t.Fatalf("expected the segments to be removed, got %v", segs)
+	}
+	if err := spill.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpillKeepsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := NewRegistry()
+	reg.Register("rows", func() Job { return &RowsJob{} })
+	spill, err := OpenSpill(dir, reg.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithSpill(spill))
+	fillPool(gp, gate)
+	for i := 0; i < 20; i++ {
+		gp.Queue(&RowsJob{Seq: i})
+	}
+	rowsSeen = nil
+	close(gate)
+	gp.Close()
+	for i, seq := range rowsSeen {
+		if seq != i {
+			t.Fatalf("unexpected order %v", rowsSeen)
+		}
+	}
+	if len(rowsSeen) != 20 {
+		t.Fatalf("expected every job to run, got %v", rowsSeen)
+	}
+}
+
+var rowsSeen []int
+
+type RowsJob struct {
+	Seq int
+}
+
+func (s *RowsJob) Execute() *JobResult {
+	rowsSeen = append(rowsSeen, s.Seq)
+	return nil
+}
+
+// slowCodec takes a while to encode, as a slow disk would
+type slowCodec struct {
+	Codec
+	d time.Duration
+}
+
+func (c *slowCodec) Encode(job Job) ([]byte, error) {
+	time.Sleep(c.d)
+	return c.Codec.Encode(job)
+}
+
+func TestSpillOutsideLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := newTestRegistry(t)
+	spill, err := OpenSpill(dir, &slowCodec{reg.Gob(), 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithSpill(spill))
+	fillPool(gp, gate)
+
+	tableJobs = nil
+	go gp.Queue(&TableJob{Table: "t", Rows: 1})
+	time.Sleep(50 * time.Millisecond)
+
+	// the pool is not locked while the job is written
+	start := time.Now()
+	if s := gp.Stats(); s.OnDisk != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("stats waited for the spill, elapsed %v", elapsed)
+	}
+	close(gate)
+	gp.Close()
+	if len(tableJobs) != 1 {
+		t.Fatalf("expected the spilled job to run, got %v", len(tableJobs))
+	}
+}
+
+func TestSpillLetsGoOfStatuses(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := newTestRegistry(t)
+	spill, err := OpenSpill(dir, reg.Gob())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithSpill(spill))
+	fillPool(gp, gate)
+
+	tableJobs = nil
+	for i := 0; i < 100; i++ {
+		gp.Queue(&TableJob{Table: "t", Rows: i})
+	}
+	f := gp.Submit(&TableJob{Table: "future"})
+
+	// only the gate jobs and the job with a Future keep their statuses
+	gp.jobs.mu.Lock()
+	n := len(gp.jobs.m)
+	gp.jobs.mu.Unlock()
+	if n != 3 {
+		t.Fatalf("expected 3 statuses in memory, got %d", n)
+	}
+	// the jobs queued after the gate jobs are 3 to 102
+	if s, err := gp.Inspect(50); err != nil || s.State != JobQueued {
+		t.Fatalf("unexpected status %+v, %v", s, err)
+	}
+	if err := gp.Cancel(50); err != nil {
+		t.Fatal(err)
+	}
+	close(gate)
+	if r := f.Result(); r.Err != nil || f.Status().State != JobSucceeded {
+		t.Fatalf("unexpected status %+v", f.Status())
+	}
+	gp.Close()
+
+	if len(tableJobs) != 100 {
+		t.Fatalf("expected every job but the cancelled one to run, got %d", len(tableJobs))
+	}
+	if s, err := gp.Inspect(50); err != nil || s.State != JobCancelled {
+		t.Fatalf("unexpected status %+v, %v", s, err)
+	}
+}
+
+func TestSpillLost(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	reg := newTestRegistry(t)
+	spill, err := OpenSpill(dir, reg.Gob())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.Close()
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithSpill(spill))
+	fillPool(gp, gate)
+
+	tableJobs = nil
+	f := gp.Submit(&TableJob{Table: "future"})
+	for i := 0; i < 10; i++ {
+		gp.Queue(&TableJob{Table: "t", Rows: i})
+	}
+	os.RemoveAll(dir)
+	close(gate)
+
+	if r := f.Result(); r.Err != ErrJobLost {
+		t.Fatalf("expected ErrJobLost, got %v", r.Err)
+	}
+	gp.Close()
+	if s := gp.Stats(); s.Lost != 11 || s.OnDisk != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if len(tableJobs) != 0 {
+		t.Fatalf("expected no spilled job to run, got %v", tableJobs)
+	}
+}
+
+func TestIDRanges(t *testing.T) {
+	var r idRanges
+	for _, id := range []uint64{5, 1, 2, 3, 7, 6, 10} {
+		r.add(id)
+	}
+	if len(r) != 3 || r[0] != [2]uint64{1, 3} || r[1] != [2]uint64{5, 7} || r[2] != [2]uint64{10, 10} {
+		t.Fatalf("unexpected ranges %v", r)
+	}
+	r.add(4)
+	if len(r) != 2 || r[0] != [2]uint64{1, 7} {
+		t.Fatalf("unexpected ranges %v", r)
+	}
+	if !r.remove(4) || r.remove(4) || r.has(4) || !r.has(3) || !r.has(5) {
+		t.Fatalf("unexpected ranges %v", r)
+	}
+	for _, id := range []uint64{1, 2, 3, 5, 6, 7, 10} {
+		if !r.remove(id) {
+			t.Fatalf("expected %d in %v", id, r)
+		}
+	}
+	if len(r) != 0 {
+		t.Fatalf("expected no ranges, got %v", r)
+	}
+}
@@ -0,0 +1,197 @@
+package sqldbutils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"github.com/wonksing/simpool"
+)
+
+var (
+	// ErrNoWorkerTx is returned when a row is executed outside of a loader worker
+	ErrNoWorkerTx = errors.New("sqldbutils: row executed outside of a loader worker")
+	// ErrLoadAborted is the error of the batches rolled back and the rows
+	// skipped because another batch has failed
+	ErrLoadAborted = errors.New("sqldbutils: load aborted by a failed batch")
+)
+
+// BatchResult is the outcome of a batch of rows executed in one transaction
+type BatchResult struct {
+	Worker    int   // the worker which owned the transaction
+	Seq       int   // the order of the batch within the worker, from 1
+	Rows      int   // rows executed in the batch
+	Committed bool  // false if the batch was rolled back
+	Err       error // the error which made the batch roll back or fail to commit
+}
+
+// workerTx is the transaction owned by a loader worker
+type workerTx struct {
+	worker int
+	tx     *sql.Tx
+	rows   int
+	seq    int
+}
+
+// TxLoader loads rows into a database with a pool whose workers each own a transaction.
+// a worker commits every 'batchSize' rows. the last batch of every worker is committed
+// together by Close, only if no batch has failed, and rolled back otherwise.
+// once a batch has failed, the open batches are rolled back and the rows
+// still to load are skipped, so only the batches committed before the failure stay.
+type TxLoader struct {
+	db        *sql.DB
+	pool      *simpool.Pool
+	batchSize int
+
+	mu      sync.Mutex
+	results []BatchResult
+	open    []*workerTx // the last batches waiting for Close
+	failed  error       // the first error of any batch
+}
+
+// NewTxLoader create loader with 'noOfWorkers' transactions
+func NewTxLoader(db *sql.DB, noOfWorkers int, maxQueueSize int, batchSize int) *TxLoader {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	l := &TxLoader{
+		db:        db,
+		batchSize: batchSize,
+	}
+	l.pool = simpool.NewPool(noOfWorkers, maxQueueSize,
+		simpool.WithWorkerInit(func(worker int) (interface{}, error) {
+			return &workerTx{worker: worker}, nil
+		}),
+		simpool.WithWorkerTeardown(func(worker int, res interface{}) {
+			l.hold(res.(*workerTx))
+		}))
+	return l
+}
+
+// Load queues a row to execute with 'sqlQry'. errors are reported by Close.
+func (l *TxLoader) Load(sqlQry string, args ...interface{}) {
+	l.pool.Queue(&loadJob{l: l, sqlQry: sqlQry, args: args})
+}
+
+// Close waits for every row to be executed and then commits the last batch of
+// every worker if no batch has failed, or rolls them back otherwise.
+// it returns the result of every batch and the first error.
+func (l *TxLoader) Close() ([]BatchResult, error) {
+	l.pool.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, wt := range l.open {
+		if l.failed != nil {
+			err := wt.tx.Rollback()
+			l.record(wt, false, err)
+			continue
+		}
+		err := wt.tx.Commit()
+		if err != nil {
+			l.failed = err
+		}
+		l.record(wt, err == nil, err)
+	}
+	l.open = nil
+	return l.results, l.failed
+}
+
+// hold keeps the last batch of a worker until Close
+func (l *TxLoader) hold(wt *workerTx) {
+	if wt.tx == nil {
+		return
+	}
+	l.mu.Lock()
+	l.open = append(l.open, wt)
+	l.mu.Unlock()
+}
+
+// record adds the result of the current batch of the worker. 'l.mu' must be held.
+func (l *TxLoader) record(wt *workerTx, committed bool, err error) {
+	wt.seq++
+	l.results = append(l.results, BatchResult{
+		Worker:    wt.worker,
+		Seq:       wt.seq,
+		Rows:      wt.rows,
+		Committed: committed,
+		Err:       err,
+	})
+	wt.tx = nil
+	wt.rows = 0
+}
+
+// aborted returns the first error of any batch, if one has failed
+func (l *TxLoader) aborted() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.failed
+}
+
+// finish commits the batch, or rolls it back if 'err' is not nil
+// or another batch has failed
+func (l *TxLoader) finish(wt *workerTx, err error) {
+	if err == nil && l.aborted() != nil {
+		err = ErrLoadAborted
+	}
+	if err != nil {
+		if wt.tx != nil {
+			wt.tx.Rollback()
+		}
+	} else {
+		err = wt.tx.Commit()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil && l.failed == nil {
+		l.failed = err
+	}
+	l.record(wt, err == nil, err)
+}
+
+// loadJob executes a row in the transaction of the worker
+type loadJob struct {
+	l      *TxLoader
+	sqlQry string
+	args   []interface{}
+}
+
+func (s *loadJob) Execute() *simpool.JobResult {
+	return &simpool.JobResult{Err: ErrNoWorkerTx}
+}
+
+func (s *loadJob) ExecuteContext(ctx context.Context) *simpool.JobResult {
+	wt, ok := simpool.WorkerResource(ctx).(*workerTx)
+	if !ok {
+		return &simpool.JobResult{Err: ErrNoWorkerTx}
+	}
+	if s.l.aborted() != nil {
+		if wt.tx != nil {
+			s.l.finish(wt, ErrLoadAborted)
+		}
+		return &simpool.JobResult{Err: ErrLoadAborted}
+	}
+	if wt.tx == nil {
+		tx, err := s.l.db.Begin()
+		if err != nil {
+			wt.rows++
+			s.l.finish(wt, err)
+			return &simpool.JobResult{Err: err}
+		}
+		wt.tx = tx
+	}
+
+	_, err := wt.tx.Exec(s.sqlQry, s.args...)
+	wt.rows++
+	if err != nil {
+		s.l.finish(wt, err)
+		return &simpool.JobResult{Err: err}
+	}
+	if wt.rows >= s.l.batchSize {
+		s.l.finish(wt, nil)
+	}
+	return &simpool.JobResult{Res: 1}
+}
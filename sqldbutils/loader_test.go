@@ -0,0 +1,143 @@
+package sqldbutils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver keeps the rows of committed transactions in memory
+type fakeDriver struct {
+	mu        sync.Mutex
+	committed int
+	failOn    string
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+func (d *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+func (d *fakeDriver) Driver() driver.Driver { return d }
+
+type fakeConn struct {
+	d    *fakeDriver
+	rows int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c: c}, nil
+}
+func (c *fakeConn) Close() error { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.rows = 0
+	return &fakeTx{c: c}, nil
+}
+
+type fakeTx struct {
+	c *fakeConn
+}
+
+func (t *fakeTx) Commit() error {
+	t.c.d.mu.Lock()
+	t.c.d.committed += t.c.rows
+	t.c.d.mu.Unlock()
+	return nil
+}
+func (t *fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	c *fakeConn
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if len(args) > 0 && args[0] == s.c.d.failOn {
+		return nil, errors.New("constraint violation")
+	}
+	s.c.rows++
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func openFake(failOn string) (*sql.DB, *fakeDriver) {
+	d := &fakeDriver{failOn: failOn}
+	return sql.OpenDB(d), d
+}
+
+func TestTxLoaderCommits(t *testing.T) {
+	db, d := openFake("")
+	defer db.Close()
+
+	l := NewTxLoader(db, 4, 10, 10)
+	for i := 0; i < 95; i++ {
+		l.Load("insert into dst(col1) values($1)", "ok")
+	}
+	results, err := l.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, 95, d.committed)
+
+	rows := 0
+	for _, r := range results {
+		assert.True(t, r.Committed)
+		rows += r.Rows
+	}
+	assert.Equal(t, 95, rows)
+}
+
+func TestTxLoaderRollsBackLastBatches(t *testing.T) {
+	db, d := openFake("bad")
+	defer db.Close()
+
+	l := NewTxLoader(db, 2, 10, 1000)
+	for i := 0; i < 50; i++ {
+		l.Load("insert into dst(col1) values($1)", "ok")
+	}
+	l.Load("insert into dst(col1) values($1)", "bad")
+	results, err := l.Close()
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, d.committed)
+
+	rows := 0
+	for _, r := range results {
+		assert.False(t, r.Committed)
+		rows += r.Rows
+	}
+	assert.Equal(t, 51, rows)
+}
+
+func TestTxLoaderStopsAfterFailure(t *testing.T) {
+	db, d := openFake("bad")
+	defer db.Close()
+
+	l := NewTxLoader(db, 1, 10, 10)
+	for i := 0; i < 200; i++ {
+		if i == 55 {
+			l.Load("insert into dst(col1) values($1)", "bad")
+			continue
+		}
+		l.Load("insert into dst(col1) values($1)", "ok")
+	}
+	results, err := l.Close()
+	assert.NotNil(t, err)
+	// only the batches before the failed one are committed
+	assert.Equal(t, 50, d.committed)
+
+	committed := 0
+	for _, r := range results {
+		if r.Committed {
+			committed++
+		}
+	}
+	assert.Equal(t, 5, committed)
+	assert.Equal(t, 6, len(results))
+}
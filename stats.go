@@ -0,0 +1,138 @@
+package simpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the pool's counters
+type Stats struct {
+	Submitted uint64 // jobs passed to Queue or QueueAndWait
+	Completed uint64 // jobs executed
+	Rejected  uint64 // jobs rejected by OverflowReject
+	Dropped   uint64 // jobs dropped by OverflowDropOldest or OverflowDropNewest
+	Expired   uint64 // jobs discarded because they waited past their start deadline
+	Cancelled uint64 // jobs cancelled with Cancel
+	Shed      uint64 // jobs rejected by CoDel load shedding
+	Coalesced uint64 // jobs coalesced into a job with the same dedupe key
+	Nested    uint64 // jobs queued with QueueAndWait from a job of the same pool
+	Queued    int    // jobs waiting in the queue
+
+	CacheHits   uint64 // jobs answered from the result cache
+	CacheMisses uint64 // cacheable jobs not found in the result cache
+
+	QueuedCost int // total cost of the jobs waiting in the queue
+	BusySlots  int // worker slots occupied by running jobs
+
+	Workers        int    // worker goroutines
+	WorkersRetired uint64 // workers retired by WithMaxJobsPerWorker or WithWorkerIdleTimeout
+
+	Spilled uint64 // jobs written to disk because the queue was full
+	OnDisk  int    // spilled jobs waiting on disk
+	Lost    uint64 // spilled jobs which could not be read back
+
+	DeadlineMissed  uint64 // jobs finished after their deadline
+	DeadlineDropped uint64 // jobs dropped because their deadline passed before they started
+
+	KeyDeferred  uint64 // jobs parked because their key was at its limit
+	LaneDeferred uint64 // jobs parked behind earlier jobs with the same ordering key
+
+	RateLimited   uint64        // jobs delayed by the rate limit
+	RateLimitWait time.Duration // total time jobs were delayed by the rate limit
+
+	Retried      uint64 // failed jobs queued again
+	Panicked     uint64 // jobs which panicked
+	DeadLettered uint64 // jobs moved to the dead-letter store
+	Stuck        uint64 // stalls reported by the watchdog
+
+	ProgressReports uint64              // progress reported with ReportProgress
+	Progress        map[uint64]Progress // the last progress of the running jobs which reported it, by job id
+}
+
+// counters are updated atomically. keep every field uint64 for alignment.
+type counters struct {
+	submitted uint64
+	completed uint64
+	rejected  uint64
+	dropped   uint64
+	expired   uint64
+	cancelled uint64
+	shed      uint64
+	coalesced uint64
+	nested    uint64
+
+	cacheHits   uint64
+	cacheMisses uint64
+
+	workersRetired uint64
+
+	spilled uint64
+	lost    uint64
+
+	deadlineMissed  uint64
+	deadlineDropped uint64
+
+	keyDeferred  uint64
+	laneDeferred uint64
+
+	rateLimited   uint64
+	rateLimitWait uint64
+
+	retried      uint64
+	panicked     uint64
+	deadLettered uint64
+	stuck        uint64
+
+	progressReports uint64
+}
+
+func (c *counters) inc(v *uint64) {
+	atomic.AddUint64(v, 1)
+}
+
+// Stats returns a snapshot of the pool's counters
+func (p *Pool) Stats() Stats {
+	c := p.counters
+	return Stats{
+		Submitted: atomic.LoadUint64(&c.submitted),
+		Completed: atomic.LoadUint64(&c.completed),
+		Rejected:  atomic.LoadUint64(&c.rejected),
+		Dropped:   atomic.LoadUint64(&c.dropped),
+		Expired:   atomic.LoadUint64(&c.expired),
+		Cancelled: atomic.LoadUint64(&c.cancelled),
+		Shed:      atomic.LoadUint64(&c.shed),
+		Coalesced: atomic.LoadUint64(&c.coalesced),
+		Nested:    atomic.LoadUint64(&c.nested),
+		Queued:    p.queued(),
+
+		CacheHits:   atomic.LoadUint64(&c.cacheHits),
+		CacheMisses: atomic.LoadUint64(&c.cacheMisses),
+
+		QueuedCost: p.queuedCostNow(),
+		BusySlots:  p.slots.inUse(),
+
+		Workers:        p.liveWorkers(),
+		WorkersRetired: atomic.LoadUint64(&c.workersRetired),
+
+		Spilled: atomic.LoadUint64(&c.spilled),
+		OnDisk:  p.spilled(),
+		Lost:    atomic.LoadUint64(&c.lost),
+
+		DeadlineMissed:  atomic.LoadUint64(&c.deadlineMissed),
+		DeadlineDropped: atomic.LoadUint64(&c.deadlineDropped),
+
+		KeyDeferred:  atomic.LoadUint64(&c.keyDeferred),
+		LaneDeferred: atomic.LoadUint64(&c.laneDeferred),
+
+		RateLimited:   atomic.LoadUint64(&c.rateLimited),
+		RateLimitWait: time.Duration(atomic.LoadUint64(&c.rateLimitWait)),
+
+		Retried:      atomic.LoadUint64(&c.retried),
+		Panicked:     atomic.LoadUint64(&c.panicked),
+		DeadLettered: atomic.LoadUint64(&c.deadLettered),
+		Stuck:        atomic.LoadUint64(&c.stuck),
+
+		ProgressReports: atomic.LoadUint64(&c.progressReports),
+		Progress:        p.running(),
+	}
+}
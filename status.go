@@ -0,0 +1,515 @@
+package simpool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrJobCancelled is delivered when the job is cancelled before it finished
+	ErrJobCancelled = errors.New("simpool: job cancelled")
+	// ErrJobNotFound is returned for an id which is unknown or no longer retained
+	ErrJobNotFound = errors.New("simpool: job not found")
+	// ErrJobFinished is returned when cancelling a job which has finished
+	ErrJobFinished = errors.New("simpool: job already finished")
+	// ErrJobNotCancellable is returned when cancelling a running job which is not a ContextJob
+	ErrJobNotCancellable = errors.New("simpool: running job cannot be cancelled")
+)
+
+const defaultStatusRetention = 1024
+
+// JobState is the state of a submitted job
+type JobState int
+
+const (
+	// JobQueued is waiting to run
+	JobQueued JobState = iota
+	// JobRunning is being executed by a worker
+	JobRunning
+	// JobSucceeded finished without an error
+	JobSucceeded
+	// JobFailed finished with an error, or was not admitted into the pool
+	JobFailed
+	// JobCancelled was cancelled with Cancel
+	JobCancelled
+	// JobExpired did not start by its start deadline or deadline
+	JobExpired
+)
+
+// String returns the name of the state
+func (s JobState) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobSucceeded:
+		return "succeeded"
+	case JobFailed:
+		return "failed"
+	case JobCancelled:
+		return "cancelled"
+	case JobExpired:
+		return "expired"
+	}
+	return "unknown"
+}
+
+// JobStatus is a snapshot of the state of a submitted job
+type JobStatus struct {
+	ID         uint64
+	State      JobState
+	Result     *JobResult // set once the job is finished
+	Progress   *Progress  // the last progress reported, if any
+	QueuedAt   time.Time
+	StartedAt  time.Time // zero until the job runs
+	FinishedAt time.Time // zero until the job is finished
+}
+
+// jobStatus tracks a submitted job
+type jobStatus struct {
+	t  *jobTable
+	id uint64
+
+	mu         sync.Mutex
+	state      JobState
+	res        *JobResult
+	queuedAt   time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	done       chan struct{}
+	job        *internalJob       // the job while it is queued in memory
+	cancel     context.CancelFunc // cancels a running ContextJob
+	cancelled  bool               // Cancel was called
+	progress   *Progress
+	watchers   []chan Progress
+	disk       bool // the job is on disk, and a Future holds the status
+}
+
+// jobTable assigns ids to jobs and keeps their statuses.
+// the statuses of unfinished jobs are always kept, and the latest
+// finished ones up to 'keep'.
+type jobTable struct {
+	counters *counters
+
+	mu       sync.Mutex
+	lastID   uint64
+	m        map[uint64]*jobStatus
+	finished []uint64 // ids of finished jobs, oldest first
+	keep     int
+
+	// the statuses of spilled jobs are let go while they are on disk,
+	// unless a Future holds them
+	disk      idRanges            // ids of the jobs on disk without a status
+	cancelled map[uint64]struct{} // ids of the jobs on disk cancelled meanwhile
+
+	unqueue func(j *internalJob) // stops counting a cancelled job in the queue
+}
+
+func newJobTable(c *counters) *jobTable {
+	return &jobTable{
+		counters: c,
+		m:        make(map[uint64]*jobStatus),
+		keep:     defaultStatusRetention,
+	}
+}
+
+// WithStatusRetention keeps the statuses of the last 'n' finished jobs
+// for Inspect. 1024 by default.
+func WithStatusRetention(n int) Option {
+	return func(p *Pool) {
+		p.jobs.keep = n
+	}
+}
+
+// add gives the job a new id and tracks it
+func (t *jobTable) add(j *internalJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastID++
+	t.attach(j, t.lastID)
+}
+
+// attach tracks the job under the id. 't.mu' must be held.
+func (t *jobTable) attach(j *internalJob, id uint64) {
+	s, ok := t.m[id]
+	if !ok {
+		s = &jobStatus{
+			t:        t,
+			id:       id,
+			state:    JobQueued,
+			queuedAt: j.EnqueuedAt,
+			done:     make(chan struct{}),
+		}
+		t.m[id] = s
+	}
+	s.mu.Lock()
+	if s.state == JobQueued {
+		s.job = j
+	}
+	s.mu.Unlock()
+	j.status = s
+}
+
+// reattach tracks a job read back from the spill under its id
+func (t *jobTable) reattach(j *internalJob, id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.disk.remove(id) {
+		if _, ok := t.cancelled[id]; ok {
+			delete(t.cancelled, id)
+			t.attach(j, id)
+			j.status.mu.Lock()
+			j.status.cancelled = true
+			j.status.mu.Unlock()
+			return
+		}
+	}
+	t.attach(j, id)
+	j.status.mu.Lock()
+	j.status.disk = false
+	j.status.mu.Unlock()
+}
+
+// spill lets go of the job, and of its status unless a Future holds it
+// or the job is no longer queued, while the job is on disk
+func (t *jobTable) spill(j *internalJob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := j.status
+	s.mu.Lock()
+	s.job = nil
+	keep := j.future || s.state != JobQueued || s.cancelled
+	s.disk = keep
+	s.mu.Unlock()
+	if !keep {
+		delete(t.m, s.id)
+		t.disk.add(s.id)
+	}
+}
+
+// onDisk reports whether the job of the id is on disk without a status
+func (t *jobTable) onDisk(id uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.disk.has(id)
+}
+
+// cancelOnDisk cancels the job of the id if it is on disk without a status.
+// it is skipped once it is read back.
+func (t *jobTable) cancelOnDisk(id uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.disk.has(id) {
+		return false
+	}
+	if t.cancelled == nil {
+		t.cancelled = make(map[uint64]struct{})
+	}
+	t.cancelled[id] = struct{}{}
+	return true
+}
+
+// lose forgets the jobs on disk, which cannot be read back.
+// the ones a Future holds finish with ErrJobLost.
+func (t *jobTable) lose() {
+	t.mu.Lock()
+	t.disk = nil
+	t.cancelled = nil
+	var lost []*jobStatus
+	for _, s := range t.m {
+		s.mu.Lock()
+		if s.disk {
+			lost = append(lost, s)
+		}
+		s.mu.Unlock()
+	}
+	t.mu.Unlock()
+
+	for _, s := range lost {
+		if s.finish(&JobResult{Err: ErrJobLost}) {
+			s.settle()
+		}
+	}
+}
+
+// idRanges is a set of ids kept as sorted ranges, which stays small
+// while the ids come mostly in order
+type idRanges [][2]uint64
+
+// find returns the index of the first range which ends at or after 'id'
+func (r idRanges) find(id uint64) int {
+	return sort.Search(len(r), func(i int) bool { return r[i][1] >= id })
+}
+
+func (r idRanges) has(id uint64) bool {
+	i := r.find(id)
+	return i < len(r) && r[i][0] <= id
+}
+
+func (r *idRanges) add(id uint64) {
+	s := *r
+	// the first range which ends right before 'id' or later
+	i := sort.Search(len(s), func(i int) bool { return s[i][1]+1 >= id })
+	switch {
+	case i < len(s) && s[i][0] <= id && id <= s[i][1]:
+		return
+	case i < len(s) && s[i][1]+1 == id:
+		s[i][1] = id
+		if i+1 < len(s) && s[i+1][0] == id+1 {
+			s[i][1] = s[i+1][1]
+			s = append(s[:i+1], s[i+2:]...)
+		}
+	case i < len(s) && s[i][0] == id+1:
+		s[i][0] = id
+	default:
+		s = append(s, [2]uint64{})
+		copy(s[i+1:], s[i:])
+		s[i] = [2]uint64{id, id}
+	}
+	*r = s
+}
+
+// remove takes the id out of the set. it returns false if it was not there.
+func (r *idRanges) remove(id uint64) bool {
+	s := *r
+	i := s.find(id)
+	if i == len(s) || s[i][0] > id {
+		return false
+	}
+	switch {
+	case s[i][0] == s[i][1]:
+		s = append(s[:i], s[i+1:]...)
+	case s[i][0] == id:
+		s[i][0]++
+	case s[i][1] == id:
+		s[i][1]--
+	default:
+		s = append(s, [2]uint64{})
+		copy(s[i+1:], s[i:])
+		s[i][1] = id - 1
+		s[i+1][0] = id + 1
+	}
+	*r = s
+	return true
+}
+
+// get returns the status of the id
+func (t *jobTable) get(id uint64) *jobStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.m[id]
+}
+
+// retire forgets the oldest finished jobs beyond 'keep'
+func (t *jobTable) retire(id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finished = append(t.finished, id)
+	for len(t.finished) > t.keep {
+		delete(t.m, t.finished[0])
+		t.finished[0] = 0
+		t.finished = t.finished[1:]
+	}
+}
+
+// start moves the job to running. it returns false if the job is cancelled.
+// 'cancel' cancels the context of a ContextJob and is nil for other jobs.
+func (s *jobStatus) start(cancel context.CancelFunc) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancelled || s.state != JobQueued {
+		return false
+	}
+	s.state = JobRunning
+	s.startedAt = time.Now()
+	s.job = nil
+	s.cancel = cancel
+	return true
+}
+
+// requeue moves a failed job back to queued for a retry
+func (s *jobStatus) requeue(j *internalJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = JobQueued
+	s.job = j
+	s.cancel = nil
+}
+
+// isCancelled reports whether Cancel was called
+func (s *jobStatus) isCancelled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancelled
+}
+
+// finish records the outcome. it returns false if the job had already finished.
+// call settle once the outcome is delivered.
+func (s *jobStatus) finish(res *JobResult) bool {
+	s.mu.Lock()
+	if s.state != JobQueued && s.state != JobRunning {
+		s.mu.Unlock()
+		return false
+	}
+	var err error
+	if res != nil {
+		err = res.Err
+	}
+	switch {
+	case err != nil && (s.cancelled || errors.Is(err, ErrJobCancelled)):
+		s.state = JobCancelled
+	case errors.Is(err, ErrJobExpired) || errors.Is(err, ErrDeadlineMissed):
+		s.state = JobExpired
+	case err != nil:
+		s.state = JobFailed
+	default:
+		s.state = JobSucceeded
+	}
+	s.res = res
+	s.finishedAt = time.Now()
+	s.job = nil
+	s.cancel = nil
+	s.mu.Unlock()
+	return true
+}
+
+// settle wakes up the futures of the finished job
+func (s *jobStatus) settle() {
+	s.mu.Lock()
+	state := s.state
+	close(s.done)
+	for _, ch := range s.watchers {
+		close(ch)
+	}
+	s.watchers = nil
+	s.mu.Unlock()
+
+	if state == JobCancelled {
+		s.t.counters.inc(&s.t.counters.cancelled)
+	}
+	s.t.retire(s.id)
+}
+
+// requestCancel cancels a queued job or signals a running ContextJob
+func (s *jobStatus) requestCancel() error {
+	s.mu.Lock()
+	switch s.state {
+	case JobQueued:
+		s.cancelled = true
+		j := s.job
+		s.mu.Unlock()
+		if j != nil {
+			// it is skipped once a worker picks it up
+			if s.t.unqueue != nil {
+				s.t.unqueue(j)
+			}
+			j.finish(&JobResult{Err: ErrJobCancelled})
+		}
+		return nil
+	case JobRunning:
+		cancel := s.cancel
+		if cancel == nil {
+			s.mu.Unlock()
+			return ErrJobNotCancellable
+		}
+		s.cancelled = true
+		s.mu.Unlock()
+		cancel()
+		return nil
+	}
+	s.mu.Unlock()
+	return ErrJobFinished
+}
+
+func (s *jobStatus) snapshot() JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return JobStatus{
+		ID:         s.id,
+		State:      s.state,
+		Result:     s.res,
+		Progress:   s.progress,
+		QueuedAt:   s.queuedAt,
+		StartedAt:  s.startedAt,
+		FinishedAt: s.finishedAt,
+	}
+}
+
+// Inspect returns the status of the job of the id
+func (p *Pool) Inspect(id uint64) (JobStatus, error) {
+	s := p.jobs.get(id)
+	if s == nil {
+		if p.jobs.onDisk(id) {
+			return JobStatus{ID: id, State: JobQueued}, nil
+		}
+		return JobStatus{}, ErrJobNotFound
+	}
+	return s.snapshot(), nil
+}
+
+// Cancel cancels the job of the id. a queued job is not run and its waiter
+// gets ErrJobCancelled. a running ContextJob has its context cancelled.
+// a running job which is not a ContextJob cannot be cancelled.
+func (p *Pool) Cancel(id uint64) error {
+	s := p.jobs.get(id)
+	if s == nil {
+		if p.jobs.cancelOnDisk(id) {
+			return nil
+		}
+		return ErrJobNotFound
+	}
+	return s.requestCancel()
+}
+
+// Future is the handle of a job queued with Submit
+type Future struct {
+	s *jobStatus
+}
+
+// Submit queues a job into the Pool and returns its Future.
+// a job which is not accepted finishes with the error right away.
+func (p *Pool) Submit(job Job, opts ...SubmitOption) *Future {
+	j := newInternalJob(job, false, opts)
+	j.future = true
+	p.submit(j)
+	return &Future{j.status}
+}
+
+// ID returns the id of the job
+func (f *Future) ID() uint64 {
+	return f.s.id
+}
+
+// Done returns a channel which is closed when the job is finished
+func (f *Future) Done() <-chan struct{} {
+	return f.s.done
+}
+
+// Result waits for the job to finish and returns its result
+func (f *Future) Result() *JobResult {
+	<-f.s.done
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	return f.s.res
+}
+
+// Status returns the status of the job
+func (f *Future) Status() JobStatus {
+	return f.s.snapshot()
+}
+
+// Cancel cancels the job, see Pool.Cancel
+func (f *Future) Cancel() error {
+	return f.s.requestCancel()
+}
@@ -0,0 +1,162 @@
+package simpool
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// WaitCtxJob runs until its context is cancelled
+type WaitCtxJob struct {
+	started chan struct{}
+}
+
+func (s *WaitCtxJob) Execute() *JobResult {
+	return nil
+}
+
+func (s *WaitCtxJob) ExecuteContext(ctx context.Context) *JobResult {
+	close(s.started)
+	<-ctx.Done()
+	return &JobResult{Err: ctx.Err()}
+}
+
+func TestSubmitAndInspect(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(1, 1)
+	running := NewGateJob("running", gate)
+	fr := gp.Submit(running)
+	<-running.started
+	fq := gp.Submit(NewGateJob("queued", gate))
+	if fr.ID() == fq.ID() {
+		t.Fatal("expected unique ids")
+	}
+
+	if s, _ := gp.Inspect(fr.ID()); s.State != JobRunning || s.StartedAt.IsZero() {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	if s, _ := gp.Inspect(fq.ID()); s.State != JobQueued {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	close(gate)
+	if r := fq.Result(); r.Res != "queued" {
+		t.Fatalf("unexpected result %+v", r)
+	}
+	gp.Close()
+	if s, _ := gp.Inspect(fr.ID()); s.State != JobSucceeded || s.Result.Res != "running" {
+		t.Fatalf("unexpected status %+v", s)
+	}
+
+	gp = NewPool(1, 1)
+	defer gp.Close()
+	f := gp.Submit(&FlakyJob{runs: new(int32), failures: 1})
+	<-f.Done()
+	if s := f.Status(); s.State != JobFailed {
+		t.Fatalf("unexpected status %+v", s)
+	}
+	f = gp.Submit(&SleepJob{}, WithStartDeadline(time.Now().Add(-time.Second)))
+	if r := f.Result(); r.Err != ErrJobExpired || f.Status().State != JobExpired {
+		t.Fatalf("unexpected status %+v", f.Status())
+	}
+	if _, err := gp.Inspect(1000); err != ErrJobNotFound {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestCancelQueued(t *testing.T) {
+	var cnt int32
+	gate := make(chan struct{})
+	gp := NewPool(1, 2)
+	fillPool(gp, gate)
+	f := gp.Submit(&CountJob{&cnt})
+	if err := gp.Cancel(f.ID()); err != nil {
+		t.Fatal(err)
+	}
+	// the waiter gets the error before the job leaves the queue
+	if r := f.Result(); r.Err != ErrJobCancelled {
+		t.Fatalf("expected ErrJobCancelled, got %v", r.Err)
+	}
+	if err := f.Cancel(); err != ErrJobFinished {
+		t.Fatalf("expected ErrJobFinished, got %v", err)
+	}
+	close(gate)
+	gp.Close()
+	if cnt != 0 {
+		t.Fatal("expected the cancelled job not to run")
+	}
+	if s := gp.Stats(); s.Cancelled != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCancelQueuedRoom(t *testing.T) {
+	var cnt int32
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithOverflowPolicy(OverflowReject))
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+	f := gp.Submit(&CountJob{&cnt})
+	if err := f.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cancelled job neither counts as queued nor takes up room
+	if s := gp.Stats(); s.Queued != 0 || s.QueuedCost != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if err := gp.Queue(&CountJob{&cnt}); err != nil {
+		t.Fatalf("expected the job queued, got %v", err)
+	}
+	close(gate)
+	gp.Close()
+	if cnt != 1 {
+		t.Fatalf("expected only the second job to run, got %d", cnt)
+	}
+	if s := gp.Stats(); s.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestCancelRunning(t *testing.T) {
+	gp := NewPool(2, 1)
+	defer gp.Close()
+
+	job := &WaitCtxJob{started: make(chan struct{})}
+	f := gp.Submit(job)
+	<-job.started
+	if err := gp.Cancel(f.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if r := f.Result(); !errors.Is(r.Err, context.Canceled) || f.Status().State != JobCancelled {
+		t.Fatalf("unexpected status %+v", f.Status())
+	}
+
+	gate := make(chan struct{})
+	running := NewGateJob("running", gate)
+	f = gp.Submit(running)
+	<-running.started
+	if err := f.Cancel(); err != ErrJobNotCancellable {
+		t.Fatalf("expected ErrJobNotCancellable, got %v", err)
+	}
+	close(gate)
+}
+
+func TestStatusRetention(t *testing.T) {
+	gp := NewPool(1, 1, WithStatusRetention(2))
+	defer gp.Close()
+
+	var ids []uint64
+	for i := 0; i < 3; i++ {
+		f := gp.Submit(&SleepJob{})
+		f.Result()
+		ids = append(ids, f.ID())
+	}
+	if _, err := gp.Inspect(ids[0]); err != ErrJobNotFound {
+		t.Fatalf("expected the oldest status to be forgotten, got %v", err)
+	}
+	if _, err := gp.Inspect(ids[2]); err != nil {
+		t.Fatal(err)
+	}
+}
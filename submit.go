@@ -0,0 +1,42 @@
+package simpool
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrJobExpired is delivered when the job is still queued after its start deadline
+var ErrJobExpired = errors.New("simpool: job expired before it started")
+
+// SubmitOption configures a single job passed to Queue or QueueAndWait
+type SubmitOption func(*internalJob)
+
+// WithStartDeadline discards the job with ErrJobExpired
+// if it has not started running by 't'
+func WithStartDeadline(t time.Time) SubmitOption {
+	return func(j *internalJob) {
+		j.StartBy = t
+	}
+}
+
+// WithQueueTTL discards the job with ErrJobExpired
+// if it waits in the queue longer than 'ttl'
+func WithQueueTTL(ttl time.Duration) SubmitOption {
+	return func(j *internalJob) {
+		j.StartBy = j.EnqueuedAt.Add(ttl)
+	}
+}
+
+// expired reports whether the job missed its start deadline
+func (e *internalJob) expired(now time.Time) bool {
+	return !e.StartBy.IsZero() && now.After(e.StartBy)
+}
+
+// WithOrderingKey runs the job after every job queued before it with the
+// same ordering key has finished, such as the events of an account.
+// jobs with different ordering keys run in parallel.
+func WithOrderingKey(key string) SubmitOption {
+	return func(j *internalJob) {
+		j.lane = key
+	}
+}
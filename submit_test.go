@@ -0,0 +1,80 @@
+package simpool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueueTTLExpiresWaitingJob(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(1, 10)
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	var cnt int32
+	res := make(chan *JobResult, 1)
+	go func() {
+		res <- gp.QueueAndWait(&CountJob{&cnt}, WithQueueTTL(10*time.Millisecond))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(gate)
+
+	r := <-res
+	if r == nil || r.Err != ErrJobExpired {
+		t.Fatalf("expected ErrJobExpired, got %v", r)
+	}
+	gp.Close()
+
+	if cnt != 0 {
+		t.Fatal("expired job must not be executed")
+	}
+	if s := gp.Stats(); s.Expired != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestStartDeadlineNotReached(t *testing.T) {
+	var cnt int32
+	gp := NewPool(1, 10)
+	r := gp.QueueAndWait(&CountJob{&cnt}, WithStartDeadline(time.Now().Add(time.Minute)))
+	gp.Close()
+	if r != nil || cnt != 1 {
+		t.Fatalf("expected the job to run, got %v", r)
+	}
+}
+
+func TestQueueTTLExpiresOnTime(t *testing.T) {
+	gate := make(chan struct{})
+	gp := NewPool(1, 1, WithOverflowPolicy(OverflowReject))
+	running := NewGateJob("running", gate)
+	gp.Queue(running)
+	<-running.started
+
+	// the waiter hears of the expiry while the worker is still busy
+	var cnt int32
+	start := time.Now()
+	r := gp.QueueAndWait(&CountJob{&cnt}, WithQueueTTL(10*time.Millisecond))
+	if r == nil || r.Err != ErrJobExpired {
+		t.Fatalf("expected ErrJobExpired, got %v", r)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Fatalf("expected the job to expire at its deadline, elapsed %v", elapsed)
+	}
+	// and the expired job leaves room in the queue
+	if s := gp.Stats(); s.Queued != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if err := gp.Queue(&CountJob{&cnt}); err != nil {
+		t.Fatalf("expected the job queued, got %v", err)
+	}
+	close(gate)
+	gp.Close()
+
+	if cnt != 1 {
+		t.Fatalf("expected only the second job to run, got %d", cnt)
+	}
+	if s := gp.Stats(); s.Expired != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
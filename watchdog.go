@@ -0,0 +1,143 @@
+package simpool
+
+import (
+	"context"
+	"runtime"
+	"time"
+)
+
+// StuckJob describes a job which has run past the watchdog threshold
+// without a heartbeat
+type StuckJob struct {
+	ID      uint64        // the id of the job
+	Worker  int           // the index of the worker running the job
+	Running time.Duration // time since the job started
+	Stack   []byte        // the stacks of all goroutines
+}
+
+// watchdog reports jobs which have not sent a heartbeat for 'threshold'
+type watchdog struct {
+	threshold time.Duration
+	fn        func(StuckJob)
+	stop      chan struct{}
+}
+
+// WithWatchdog calls 'fn' once a job has run for 'threshold' since it started
+// or since its last Heartbeat. it is called once per stall, from a goroutine of
+// its own, so that a hung Execute is noticed rather than silently holding a worker.
+func WithWatchdog(threshold time.Duration, fn func(StuckJob)) Option {
+	return func(p *Pool) {
+		p.watchdog = &watchdog{threshold: threshold, fn: fn}
+	}
+}
+
+// Heartbeat tells the watchdog that the ContextJob running with 'ctx' is making progress
+func Heartbeat(ctx context.Context) {
+	if w, ok := ctx.Value(workerKey{}).(*worker); ok {
+		w.heartbeat(time.Now())
+	}
+}
+
+// begin records that the worker started the job. it returns the job the
+// worker was running before, which is waiting for a nested job, and its start.
+func (w *worker) begin(s *jobStatus, now time.Time) (*jobStatus, time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	prev, started := w.job, w.started
+	w.job = s
+	w.started = now
+	w.beat = now
+	w.reported = false
+	return prev, started
+}
+
+// end records that the worker finished its job and is back to
+// the job it was running before, if any
+func (w *worker) end(prev *jobStatus, started time.Time, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.job = prev
+	w.started = started
+	w.beat = now
+	w.reported = false
+}
+
+func (w *worker) heartbeat(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.beat = now
+	w.reported = false
+}
+
+// stuck returns the job of the worker which has not sent a heartbeat for
+// 'threshold' and was not reported yet
+func (w *worker) stuck(now time.Time, threshold time.Duration) (StuckJob, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.job == nil || w.reported || now.Sub(w.beat) < threshold {
+		return StuckJob{}, false
+	}
+	w.reported = true
+	return StuckJob{ID: w.job.id, Worker: w.index, Running: now.Sub(w.started)}, true
+}
+
+// startWatchdog starts checking the workers until the pool is closed
+func (p *Pool) startWatchdog() {
+	if p.watchdog == nil {
+		return
+	}
+	p.watchdog.stop = make(chan struct{})
+	go p.watch(p.watchdog.stop)
+}
+
+// stopWatchdog stops checking the workers
+func (p *Pool) stopWatchdog() {
+	if p.watchdog != nil {
+		close(p.watchdog.stop)
+	}
+}
+
+func (p *Pool) watch(stop chan struct{}) {
+	interval := p.watchdog.threshold / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-t.C:
+			p.mu.Lock()
+			workers := append([]*worker(nil), p.workers...)
+			p.mu.Unlock()
+			for _, w := range workers {
+				if w == nil {
+					continue
+				}
+				if sj, ok := w.stuck(now, p.watchdog.threshold); ok {
+					p.counters.inc(&p.counters.stuck)
+					sj.Stack = stacks()
+					p.watchdog.fn(sj)
+				}
+			}
+		}
+	}
+}
+
+// stacks returns the stacks of all goroutines
+func stacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
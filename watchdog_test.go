@@ -0,0 +1,57 @@
+package simpool
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// BeatJob sends heartbeats while it runs for 'd'
+type BeatJob struct {
+	d time.Duration
+}
+
+func (s *BeatJob) Execute() *JobResult {
+	return nil
+}
+
+func (s *BeatJob) ExecuteContext(ctx context.Context) *JobResult {
+	end := time.Now().Add(s.d)
+	for time.Now().Before(end) {
+		Heartbeat(ctx)
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestWatchdog(t *testing.T) {
+	stuck := make(chan StuckJob, 10)
+	gp := NewPool(1, 1, WithWatchdog(40*time.Millisecond, func(sj StuckJob) {
+		stuck <- sj
+	}))
+
+	gp.QueueAndWait(&BeatJob{150 * time.Millisecond})
+	if len(stuck) != 0 {
+		t.Fatalf("expected no stall for a job sending heartbeats, got %+v", <-stuck)
+	}
+
+	gate := make(chan struct{})
+	f := gp.Submit(NewGateJob("hung", gate))
+	sj := <-stuck
+	if sj.ID != f.ID() || sj.Worker != 0 || sj.Running < 40*time.Millisecond {
+		t.Fatalf("unexpected stall %+v", sj)
+	}
+	if !bytes.Contains(sj.Stack, []byte("GateJob")) {
+		t.Fatalf("expected the stack of the job, got %s", sj.Stack)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(gate)
+	gp.Close()
+	if len(stuck) != 0 {
+		t.Fatal("expected a stall to be reported once")
+	}
+	if s := gp.Stats(); s.Stuck != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
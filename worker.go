@@ -0,0 +1,110 @@
+package simpool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ContextJob is a Job which receives a context when it is executed.
+// the pool calls ExecuteContext instead of Execute, and the context
+// carries the worker's resource, see WorkerResource.
+type ContextJob interface {
+	Job
+	ExecuteContext(ctx context.Context) *JobResult
+}
+
+// worker is the state of a worker goroutine
+type worker struct {
+	index int
+	res   interface{}
+	ready bool  // the resource is initialized
+	err   error // the last error from the initializer
+	jobs  int   // jobs run
+	// nested waits in progress. the worker runs other jobs meanwhile
+	// within the slots of the job which is waiting.
+	helping int
+	goid    uint64 // the id of the worker's goroutine. guarded by 'p.mu'
+
+	// the running job, for the watchdog
+	mu       sync.Mutex
+	job      *jobStatus // nil while idle
+	started  time.Time
+	beat     time.Time // the last heartbeat
+	reported bool      // the watchdog has reported the stall
+}
+
+type workerKey struct{}
+
+// context returns 'ctx' carrying the worker. a nil worker adds nothing.
+func (w *worker) context(ctx context.Context) context.Context {
+	if w == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, workerKey{}, w)
+}
+
+// WithWorkerInit sets a function which runs once in each worker goroutine
+// before it executes its first job. the returned resource, such as a DB connection,
+// a prepared statement or a buffer, is given to every job the worker executes
+// through WorkerResource. if it fails, the job the worker picked fails with
+// the error and the worker tries again for its next job.
+func WithWorkerInit(init func(worker int) (interface{}, error)) Option {
+	return func(p *Pool) {
+		p.workerInit = init
+	}
+}
+
+// WithWorkerTeardown sets a function which runs with the worker's resource
+// when the worker exits
+func WithWorkerTeardown(teardown func(worker int, res interface{})) Option {
+	return func(p *Pool) {
+		p.workerTeardown = teardown
+	}
+}
+
+// WorkerResource returns the resource created by WithWorkerInit for the worker
+// executing the job, or nil if there is none
+func WorkerResource(ctx context.Context) interface{} {
+	if w, ok := ctx.Value(workerKey{}).(*worker); ok {
+		return w.res
+	}
+	return nil
+}
+
+// WorkerIndex returns the index of the worker executing the job,
+// or -1 if the job is not running on a worker
+func WorkerIndex(ctx context.Context) int {
+	if w, ok := ctx.Value(workerKey{}).(*worker); ok {
+		return w.index
+	}
+	return -1
+}
+
+// setupWorker initializes the worker's resource if it is not yet
+func (p *Pool) setupWorker(w *worker) bool {
+	if w.ready {
+		return true
+	}
+	if p.workerInit == nil {
+		w.ready = true
+		return true
+	}
+	res, err := p.workerInit(w.index)
+	if err != nil {
+		w.err = fmt.Errorf("simpool: worker init: %w", err)
+		return false
+	}
+	w.res = res
+	w.err = nil
+	w.ready = true
+	return true
+}
+
+// teardownWorker releases the worker's resource
+func (p *Pool) teardownWorker(w *worker) {
+	if w.ready && p.workerInit != nil && p.workerTeardown != nil {
+		p.workerTeardown(w.index, w.res)
+	}
+}
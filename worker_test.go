@@ -0,0 +1,90 @@
+package simpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type buffer struct {
+	worker int
+	used   int
+}
+
+type BufferJob struct{}
+
+func (s *BufferJob) Execute() *JobResult {
+	return &JobResult{Err: errors.New("expected ExecuteContext")}
+}
+
+func (s *BufferJob) ExecuteContext(ctx context.Context) *JobResult {
+	buf, ok := WorkerResource(ctx).(*buffer)
+	if !ok || buf.worker != WorkerIndex(ctx) {
+		return &JobResult{Err: errors.New("unexpected worker resource")}
+	}
+	// no locking since the buffer belongs to this worker only
+	buf.used++
+	return &JobResult{Res: buf.worker}
+}
+
+func TestWorkerResource(t *testing.T) {
+	var mu sync.Mutex
+	var torn []*buffer
+	inits := 0
+	gp := NewPool(4, 10,
+		WithWorkerInit(func(worker int) (interface{}, error) {
+			mu.Lock()
+			inits++
+			mu.Unlock()
+			return &buffer{worker: worker}, nil
+		}),
+		WithWorkerTeardown(func(worker int, res interface{}) {
+			mu.Lock()
+			torn = append(torn, res.(*buffer))
+			mu.Unlock()
+		}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r := gp.QueueAndWait(&BufferJob{}); r.Err != nil {
+				t.Error(r.Err)
+			}
+		}()
+	}
+	wg.Wait()
+	gp.Close()
+
+	if inits != 4 || len(torn) != 4 {
+		t.Fatalf("expected 4 inits and teardowns, got %v and %v", inits, len(torn))
+	}
+	used := 0
+	for _, b := range torn {
+		used += b.used
+	}
+	if used != 100 {
+		t.Fatalf("expected 100 jobs, got %v", used)
+	}
+}
+
+func TestWorkerInitFailure(t *testing.T) {
+	fail := true
+	gp := NewPool(1, 10, WithWorkerInit(func(worker int) (interface{}, error) {
+		if fail {
+			fail = false
+			return nil, errors.New("no connection")
+		}
+		return &buffer{worker: worker}, nil
+	}))
+
+	if r := gp.QueueAndWait(&BufferJob{}); r.Err == nil {
+		t.Fatal("expected the init error")
+	}
+	if r := gp.QueueAndWait(&BufferJob{}); r.Err != nil {
+		t.Fatalf("expected the worker to recover, got %v", r.Err)
+	}
+	gp.Close()
+}